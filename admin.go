@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lobre/bow"
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// bootstrapUsername is the name of the admin account
+	// created when setting up the application.
+	bootstrapUsername = "admin"
+
+	minPasswordLength = 8
+	maxUsernameLength = 50
+)
+
+// Admin is a named account that can enter the admin mode.
+type Admin struct {
+	ID        int
+	Username  string
+	Disabled  bool
+	CreatedAt time.Time
+}
+
+type AdminService struct {
+	db *bow.DB
+}
+
+// HasAdmins reports whether at least one admin account exists.
+// Without one, the admin mode stays freely accessible.
+func (s *AdminService) HasAdmins(ctx context.Context) (has bool, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var n int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM admins`).Scan(&n)
+		has = n > 0
+		return err
+	})
+
+	return has, err
+}
+
+// Authenticate checks the given credentials against the enabled admin accounts.
+// It returns ErrInvalidCredentials if they don’t match.
+func (s *AdminService) Authenticate(ctx context.Context, username, password string) (*Admin, error) {
+	var admin *Admin
+	var hash string
+
+	err := withTx(ctx, s.db, func(tx *sql.Tx) (err error) {
+		admin, hash, err = findAdminByUsername(ctx, tx, username)
+		return err
+	})
+	if errors.Is(err, ErrNoRecord) {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || (err == nil && admin.Disabled) {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	return admin, nil
+}
+
+func (s *AdminService) FindAdminByID(ctx context.Context, id int) (admin *Admin, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		admin, err = findAdminByID(ctx, tx, id)
+		return err
+	})
+
+	return admin, err
+}
+
+func (s *AdminService) FindAdmins(ctx context.Context) (admins []*Admin, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		admins, err = findAdmins(ctx, tx)
+		return err
+	})
+
+	return admins, err
+}
+
+// CreateAdmin creates an admin account. It returns
+// ErrDuplicateUsername if the username is already taken.
+func (s *AdminService) CreateAdmin(ctx context.Context, admin *Admin, password string) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return createAdmin(ctx, tx, admin, password)
+	})
+}
+
+// SetAdminDisabled disables or enables back an admin account. It returns
+// ErrLastAdmin when disabling the last enabled account, as nobody
+// would then be able to enter the admin mode.
+func (s *AdminService) SetAdminDisabled(ctx context.Context, id int, disabled bool) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if disabled {
+			var n int
+			err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM admins WHERE disabled = 0 AND id <> ?`, id).Scan(&n)
+			if err != nil {
+				return err
+			}
+
+			if n == 0 {
+				return ErrLastAdmin
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, `UPDATE admins SET disabled = ? WHERE id = ?`, disabled, id)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNoRecord
+		}
+
+		return nil
+	})
+}
+
+func findAdmins(ctx context.Context, tx *sql.Tx) ([]*Admin, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, username, disabled, created_at FROM admins ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	admins := make([]*Admin, 0)
+
+	for rows.Next() {
+		var admin Admin
+
+		err = rows.Scan(&admin.ID, &admin.Username, &admin.Disabled, &admin.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		admins = append(admins, &admin)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return admins, nil
+}
+
+func findAdminByID(ctx context.Context, tx *sql.Tx, id int) (*Admin, error) {
+	row := tx.QueryRowContext(ctx, `SELECT id, username, disabled, created_at FROM admins WHERE id = ?`, id)
+
+	var admin Admin
+	err := row.Scan(&admin.ID, &admin.Username, &admin.Disabled, &admin.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &admin, nil
+}
+
+// findAdminByUsername returns the admin with the given username
+// along with the bcrypt hash of its password.
+func findAdminByUsername(ctx context.Context, tx *sql.Tx, username string) (*Admin, string, error) {
+	row := tx.QueryRowContext(ctx, `SELECT id, username, disabled, created_at, password_hash FROM admins WHERE username = ?`, username)
+
+	var admin Admin
+	var hash string
+	err := row.Scan(&admin.ID, &admin.Username, &admin.Disabled, &admin.CreatedAt, &hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrNoRecord
+		}
+		return nil, "", err
+	}
+
+	return &admin, hash, nil
+}
+
+func createAdmin(ctx context.Context, tx *sql.Tx, admin *Admin, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	admin.CreatedAt = time.Now().UTC()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO admins (username, password_hash, disabled, created_at) VALUES (?, ?, ?, ?)`,
+		admin.Username,
+		string(hash),
+		admin.Disabled,
+		admin.CreatedAt,
+	)
+	if err != nil {
+		var sqliteError sqlite3.Error
+		if errors.As(err, &sqliteError) {
+			if sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique && strings.Contains(sqliteError.Error(), "admins.username") {
+				return ErrDuplicateUsername
+			}
+		}
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	admin.ID = int(id)
+
+	return nil
+}
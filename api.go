@@ -0,0 +1,448 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxAPIBodySize is the maximum size of the body of an API request.
+// Event updates are small JSON objects, even with a long description.
+const maxAPIBodySize = 64 << 10
+
+// apiEvent is the JSON representation of an event.
+type apiEvent struct {
+	ID              int               `json:"id"`
+	Title           string            `json:"title"`
+	StartsAt        time.Time         `json:"starts_at"`
+	EndsAt          *time.Time        `json:"ends_at"`
+	AllDay          bool              `json:"all_day"`
+	DefaultNo       bool              `json:"default_no"`
+	MinAttendees    *int64            `json:"min_attendees"`
+	MaxAttendees    *int64            `json:"max_attendees"`
+	Description     *string           `json:"description"`
+	Status          *apiStatus        `json:"status"`
+	ResponsesOpenAt *time.Time        `json:"responses_open_at"`
+	UpdatedAt       *time.Time        `json:"updated_at"`
+	Fields          map[string]string `json:"fields"`
+}
+
+// apiRoster is the JSON representation of an event with the responses of its guests.
+type apiRoster struct {
+	*apiEvent
+
+	Counts         map[string]int      `json:"counts"`
+	Participations []*apiParticipation `json:"participations"`
+}
+
+// apiParticipation is the response of a guest. Attend is
+// null for guests who haven’t answered yet, unless the event
+// counts them as not attending, in which case Assumed is set.
+type apiParticipation struct {
+	GuestID   int    `json:"guest_id"`
+	GuestName string `json:"guest_name"`
+	Attend    *int64 `json:"attend"`
+	Label     string `json:"label"`
+	Assumed   bool   `json:"assumed,omitempty"`
+}
+
+type apiStatus struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+	Color string `json:"color"`
+}
+
+func newAPIEvent(evt *Event) *apiEvent {
+	out := apiEvent{
+		ID:              evt.ID,
+		Title:           evt.Title,
+		StartsAt:        evt.StartsAt,
+		EndsAt:          nullTime(evt.EndsAt),
+		AllDay:          evt.AllDay,
+		DefaultNo:       evt.DefaultNo,
+		MinAttendees:    nullInt(evt.MinAttendees),
+		MaxAttendees:    nullInt(evt.MaxAttendees),
+		ResponsesOpenAt: nullTime(evt.ResponsesOpenAt),
+		UpdatedAt:       nullTime(evt.UpdatedAt),
+		Fields:          evt.Fields,
+	}
+
+	if evt.Description.Valid {
+		out.Description = &evt.Description.String
+	}
+
+	if evt.Status != nil {
+		out.Status = &apiStatus{ID: evt.Status.ID, Label: evt.Status.Label, Color: evt.Status.Color}
+	}
+
+	return &out
+}
+
+// newAPIRoster builds the roster of an event. The counts
+// follow the given mode for "if needed" responses.
+func newAPIRoster(evt *Event, ifNeeded string) *apiRoster {
+	out := apiRoster{
+		apiEvent:       newAPIEvent(evt),
+		Counts:         make(map[string]int),
+		Participations: make([]*apiParticipation, 0, len(evt.Participations)),
+	}
+
+	for _, part := range evt.Participations {
+		p := apiParticipation{
+			GuestID:   part.Guest.ID,
+			GuestName: part.Guest.Name,
+			Label:     NoAnswerText,
+			Assumed:   part.Assumed,
+		}
+
+		counted := p.Label
+
+		if part.Attend.Valid {
+			p.Attend = &part.Attend.Int64
+			p.Label = AttendText[part.Attend.Int64]
+			counted = AttendText[countedAttend(part.Attend.Int64, ifNeeded)]
+		}
+
+		out.Counts[counted]++
+		out.Participations = append(out.Participations, &p)
+	}
+
+	return &out
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes an error message as a JSON body.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// isJSONNull reports whether raw is the JSON null literal.
+func isJSONNull(raw json.RawMessage) bool {
+	return strings.TrimSpace(string(raw)) == "null"
+}
+
+// parseEventPatch builds an EventUpdate from a JSON object. Only the keys present
+// in the object are set in the update, so that omitted fields are left unchanged.
+// A null value clears the fields that can be empty.
+func (app *application) parseEventPatch(body map[string]json.RawMessage) (EventUpdate, error) {
+	var upd EventUpdate
+
+	for key, raw := range body {
+		switch key {
+		case "title":
+			var title string
+			if err := json.Unmarshal(raw, &title); err != nil || strings.TrimSpace(title) == "" {
+				return upd, errors.New("title must be a non empty string")
+			}
+			if utf8.RuneCountInString(title) > app.config.maxTitleLength {
+				return upd, fmt.Errorf("title is too long (maximum is %d characters)", app.config.maxTitleLength)
+			}
+			upd.Title = &title
+
+		case "starts_at":
+			var startsAt time.Time
+			if err := json.Unmarshal(raw, &startsAt); err != nil || isJSONNull(raw) {
+				return upd, errors.New("starts_at must be a RFC 3339 date")
+			}
+			upd.StartsAt = &startsAt
+
+		case "ends_at", "responses_open_at":
+			var t sql.NullTime
+			if !isJSONNull(raw) {
+				if err := json.Unmarshal(raw, &t.Time); err != nil {
+					return upd, fmt.Errorf("%s must be a RFC 3339 date or null", key)
+				}
+				t.Valid = true
+			}
+			if key == "ends_at" {
+				upd.EndsAt = &t
+			} else {
+				upd.ResponsesOpenAt = &t
+			}
+
+		case "all_day":
+			var allDay bool
+			if err := json.Unmarshal(raw, &allDay); err != nil || isJSONNull(raw) {
+				return upd, errors.New("all_day must be a boolean")
+			}
+			upd.AllDay = &allDay
+
+		case "default_no":
+			var defaultNo bool
+			if err := json.Unmarshal(raw, &defaultNo); err != nil || isJSONNull(raw) {
+				return upd, errors.New("default_no must be a boolean")
+			}
+			upd.DefaultNo = &defaultNo
+
+		case "min_attendees", "max_attendees":
+			var n sql.NullInt64
+			if !isJSONNull(raw) {
+				if err := json.Unmarshal(raw, &n.Int64); err != nil || n.Int64 <= 0 {
+					return upd, fmt.Errorf("%s must be a positive integer or null", key)
+				}
+				n.Valid = true
+			}
+			if key == "min_attendees" {
+				upd.MinAttendees = &n
+			} else {
+				upd.MaxAttendees = &n
+			}
+
+		case "description":
+			var description sql.NullString
+			if !isJSONNull(raw) {
+				if err := json.Unmarshal(raw, &description.String); err != nil {
+					return upd, errors.New("description must be a string or null")
+				}
+				if utf8.RuneCountInString(description.String) > app.config.maxDescriptionLength {
+					return upd, fmt.Errorf("description is too long (maximum is %d characters)", app.config.maxDescriptionLength)
+				}
+				description.Valid = description.String != ""
+			}
+			upd.Description = &description
+
+		case "status":
+			var statusID sql.NullInt64
+			if !isJSONNull(raw) {
+				if err := json.Unmarshal(raw, &statusID.Int64); err != nil {
+					return upd, errors.New("status must be a status id or null")
+				}
+				statusID.Valid = true
+			} else if app.config.requireStatus {
+				return upd, errors.New("status is required")
+			}
+			upd.StatusID = &statusID
+
+		case "fields":
+			fields := make(map[string]string)
+			if !isJSONNull(raw) {
+				if err := json.Unmarshal(raw, &fields); err != nil {
+					return upd, errors.New("fields must be an object of strings or null")
+				}
+			}
+			for k, v := range fields {
+				if strings.TrimSpace(k) == "" || len(k) > maxFieldKeyLength || len(v) > maxFieldValueLength {
+					return upd, errors.New("a custom field is empty or too long")
+				}
+			}
+			upd.Fields = &fields
+
+		default:
+			return upd, fmt.Errorf("unknown field %s", key)
+		}
+	}
+
+	return upd, nil
+}
+
+// checkEventPatch makes sure the event stays consistent once the update is
+// applied, as the patch alone can’t tell: it may only change one of the
+// bounds. All day events end at the midnight of their last day, which
+// can be the one of their start.
+func checkEventPatch(evt *Event, upd EventUpdate) error {
+	startsAt, endsAt, allDay := evt.StartsAt, evt.EndsAt, evt.AllDay
+	if upd.StartsAt != nil {
+		startsAt = *upd.StartsAt
+	}
+	if upd.EndsAt != nil {
+		endsAt = *upd.EndsAt
+	}
+	if upd.AllDay != nil {
+		allDay = *upd.AllDay
+	}
+
+	if endsAt.Valid && (endsAt.Time.Before(startsAt) || !allDay && endsAt.Time.Equal(startsAt)) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	min, max := evt.MinAttendees, evt.MaxAttendees
+	if upd.MinAttendees != nil {
+		min = *upd.MinAttendees
+	}
+	if upd.MaxAttendees != nil {
+		max = *upd.MaxAttendees
+	}
+
+	if min.Valid && max.Valid && min.Int64 > max.Int64 {
+		return errors.New("min_attendees cannot be above max_attendees")
+	}
+
+	return nil
+}
+
+// apiFindEvent returns an event with its roster. It is available to recognized
+// guests and to clients passing a feed token, such as a check-in kiosk.
+// Responses carry an ETag, so that polling clients only download the roster
+// when it has changed.
+func (app *application) apiFindEvent(w http.ResponseWriter, r *http.Request) {
+	if currentGuest(r) == nil {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			writeJSONError(w, http.StatusUnauthorized, "a session or a token is required")
+			return
+		}
+
+		_, n, err := app.guestService.FindGuests(r.Context(), GuestFilter{FeedToken: &token})
+		if err != nil {
+			app.errorLog.Println(err)
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		} else if n == 0 {
+			writeJSONError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "event not found")
+		return
+	}
+
+	evt, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			writeJSONError(w, http.StatusNotFound, "event not found")
+		} else {
+			app.errorLog.Println(err)
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	body, err := json.Marshal(newAPIRoster(evt, app.config.ifNeeded))
+	if err != nil {
+		app.errorLog.Println(err)
+		writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// responses don’t change the update date of the event,
+	// so the tag is computed from the whole roster
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// apiUpdateEvent applies a partial update to an event. It is mounted without
+// the CSRF check, which clients of the API can’t pass, so the admin mode is
+// checked here. PATCH requests can’t be sent across sites without a preflight
+// request, which is never allowed, so they can’t be forged by other pages.
+func (app *application) apiUpdateEvent(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "the admin mode is required")
+		return
+	}
+
+	// keep track of who changes what, as for the other admin routes
+	if admin := currentAdmin(r); admin != nil {
+		app.Logger.Printf("admin %s: %s %s", admin.Username, r.Method, r.URL.Path)
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "event not found")
+		return
+	}
+
+	// the body is limited by the api chain, which makes reading it fail
+	data, err := io.ReadAll(r.Body)
+	if err != nil && len(data) >= maxAPIBodySize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not exceed %d bytes", maxAPIBodySize))
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "body cannot be read")
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil || body == nil {
+		writeJSONError(w, http.StatusBadRequest, "body must be a JSON object")
+		return
+	}
+
+	upd, err := app.parseEventPatch(body)
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	evt, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			writeJSONError(w, http.StatusNotFound, "event not found")
+		} else {
+			app.errorLog.Println(err)
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	if err := checkEventPatch(evt, upd); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if upd.StatusID != nil && upd.StatusID.Valid {
+		_, err := app.statusService.FindStatusByID(r.Context(), int(upd.StatusID.Int64))
+		if errors.Is(err, ErrNoRecord) {
+			writeJSONError(w, http.StatusUnprocessableEntity, "status does not exist")
+			return
+		} else if err != nil {
+			app.errorLog.Println(err)
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+	}
+
+	_, err = app.eventService.UpdateEvent(r.Context(), id, upd, app.actorName(r))
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			writeJSONError(w, http.StatusNotFound, "event not found")
+		} else {
+			app.errorLog.Println(err)
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	// read the event back to get its status and fields
+	evt, err = app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		app.errorLog.Println(err)
+		writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAPIEvent(evt))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// patchEvent sends a partial update of an event without CSRF token, as API clients do.
+func patchEvent(c *testClient, id int, body string) (int, string) {
+	c.t.Helper()
+
+	header := http.Header{"Content-Type": {"application/json"}, "X-Csrf-Token": {""}}
+	return c.send(http.MethodPatch, fmt.Sprintf("/api/events/%d", id), strings.NewReader(body), header)
+}
+
+func TestAPIUpdateEventTitleOnly(t *testing.T) {
+	app := newTestApp(t, nil)
+
+	startsAt := time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC)
+	event := &Event{
+		Title:       "Rehearsal",
+		StartsAt:    startsAt,
+		EndsAt:      sql.NullTime{Time: startsAt.Add(3 * time.Hour), Valid: true},
+		Description: sql.NullString{String: "Bring the scores", Valid: true},
+	}
+	if err := app.eventService.CreateEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+
+	code, body := patchEvent(c, event.ID, `{"title": "Concert"}`)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d: %s", code, body)
+	}
+
+	var out apiEvent
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Title != "Concert" {
+		t.Errorf("got title %q in the response, want %q", out.Title, "Concert")
+	}
+
+	got, err := app.eventService.FindEventByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Title != "Concert" {
+		t.Errorf("got title %q, want %q", got.Title, "Concert")
+	}
+	if !got.StartsAt.Equal(startsAt) {
+		t.Errorf("got start %s, want %s", got.StartsAt, startsAt)
+	}
+	if !got.EndsAt.Valid || !got.EndsAt.Time.Equal(event.EndsAt.Time) {
+		t.Errorf("got end %v, want %s", got.EndsAt, event.EndsAt.Time)
+	}
+	if got.Description != event.Description {
+		t.Errorf("got description %v, want %v", got.Description, event.Description)
+	}
+}
+
+func TestAPIUpdateEventRequiresAdmin(t *testing.T) {
+	app := newTestApp(t, nil)
+	guest := mustCreateGuest(t, app, "Alice")
+	event := mustCreateEvent(t, app, "Rehearsal", time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC))
+
+	c := newTestClient(t, app).asGuest(guest.ID)
+
+	if code, body := patchEvent(c, event.ID, `{"title": "Concert"}`); code != http.StatusUnauthorized {
+		t.Fatalf("got status %d: %s", code, body)
+	}
+
+	got, err := app.eventService.FindEventByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Rehearsal" {
+		t.Errorf("got title %q, want it unchanged", got.Title)
+	}
+}
+
+func TestAPIUpdateEventChecksMergedValues(t *testing.T) {
+	app := newTestApp(t, nil)
+
+	startsAt := time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC)
+	event := &Event{
+		Title:        "Rehearsal",
+		StartsAt:     startsAt,
+		EndsAt:       sql.NullTime{Time: startsAt.Add(3 * time.Hour), Valid: true},
+		MinAttendees: sql.NullInt64{Int64: 3, Valid: true},
+		MaxAttendees: sql.NullInt64{Int64: 10, Valid: true},
+	}
+	if err := app.eventService.CreateEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"min_attendees": 12}`, http.StatusUnprocessableEntity},
+		{`{"max_attendees": 2}`, http.StatusUnprocessableEntity},
+		{`{"min_attendees": 12, "max_attendees": null}`, http.StatusOK},
+		{`{"starts_at": "2030-06-01T22:00:00Z"}`, http.StatusUnprocessableEntity},
+		{`{"ends_at": "2030-06-01T18:30:00Z"}`, http.StatusUnprocessableEntity},
+		{`{"ends_at": "2030-06-01T18:00:00Z", "starts_at": "2030-06-01T17:00:00Z"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if code, body := patchEvent(c, event.ID, tt.body); code != tt.code {
+			t.Errorf("patching %s: got status %d, want %d: %s", tt.body, code, tt.code, body)
+		}
+	}
+}
+
+func TestAPIUpdateEventBodyTooLarge(t *testing.T) {
+	app := newTestApp(t, nil)
+	event := mustCreateEvent(t, app, "Rehearsal", time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC))
+
+	c := newTestClient(t, app).asAdmin()
+
+	description := strings.Repeat("a", maxAPIBodySize)
+	if code, body := patchEvent(c, event.ID, `{"description": "`+description+`"}`); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got status %d: %s", code, body)
+	}
+
+	got, err := app.eventService.FindEventByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Description.Valid {
+		t.Errorf("got description of %d bytes, want it unchanged", len(got.Description.String))
+	}
+
+	if code, body := patchEvent(c, event.ID, `{"title": "Concert"}`); code != http.StatusOK {
+		t.Errorf("a small body: got status %d: %s", code, body)
+	}
+}
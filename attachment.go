@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// maxAttachmentSize is the maximum size in bytes of an uploaded file.
+const maxAttachmentSize = 10 << 20
+
+// attachmentTypes is the list of content types that can be uploaded.
+var attachmentTypes = []string{
+	"application/pdf",
+	"image/gif",
+	"image/jpeg",
+	"image/png",
+	"image/webp",
+	"text/plain",
+}
+
+// allowedAttachmentType returns true if the given
+// content type can be uploaded, false otherwise.
+func allowedAttachmentType(contentType string) bool {
+	for _, t := range attachmentTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+type Attachment struct {
+	ID          int
+	EventID     int
+	Filename    string
+	ContentType string
+	Size        int64
+	CreatedAt   time.Time
+
+	// This is only set when returning a single attachment.
+	Data []byte
+}
+
+func (s *EventService) FindAttachmentByID(ctx context.Context, id int) (att *Attachment, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		att, err = findAttachmentByID(ctx, tx, id)
+		return err
+	})
+
+	return att, err
+}
+
+func (s *EventService) CreateAttachment(ctx context.Context, att *Attachment) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return createAttachment(ctx, tx, att)
+	})
+}
+
+// DeleteAttachment removes an attachment of an event. ErrNoRecord
+// is returned when the event has no such attachment.
+func (s *EventService) DeleteAttachment(ctx context.Context, eventID, id int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return deleteAttachment(ctx, tx, eventID, id)
+	})
+}
+
+// findAttachmentsByEvent fetches the attachments of an event.
+// The content of the files is not retrieved.
+func findAttachmentsByEvent(ctx context.Context, tx *sql.Tx, id int) (_ []*Attachment, n int, err error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT
+			id,
+			event_id,
+			filename,
+			content_type,
+			size,
+			created_at,
+			COUNT(*) OVER()
+		FROM event_attachments
+		WHERE event_id = ?
+		ORDER BY filename`,
+		id,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	attachments := make([]*Attachment, 0)
+
+	for rows.Next() {
+		var att Attachment
+
+		err = rows.Scan(&att.ID, &att.EventID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt, &n)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		attachments = append(attachments, &att)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return attachments, n, nil
+}
+
+func findAttachmentByID(ctx context.Context, tx *sql.Tx, id int) (*Attachment, error) {
+	row := tx.QueryRowContext(ctx,
+		`SELECT id, event_id, filename, content_type, size, created_at, data FROM event_attachments WHERE id = ?`,
+		id,
+	)
+
+	var att Attachment
+	err := row.Scan(&att.ID, &att.EventID, &att.Filename, &att.ContentType, &att.Size, &att.CreatedAt, &att.Data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &att, nil
+}
+
+func createAttachment(ctx context.Context, tx *sql.Tx, att *Attachment) error {
+	att.CreatedAt = time.Now().UTC()
+	att.Size = int64(len(att.Data))
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO event_attachments (event_id, filename, content_type, size, data, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		att.EventID,
+		att.Filename,
+		att.ContentType,
+		att.Size,
+		att.Data,
+		att.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	att.ID = int(id)
+
+	return nil
+}
+
+func deleteAttachment(ctx context.Context, tx *sql.Tx, eventID, id int) error {
+	res, err := tx.ExecContext(ctx, `DELETE FROM event_attachments WHERE id = ? AND event_id = ?`, id, eventID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeleteAttachmentOfAnotherEvent(t *testing.T) {
+	app := newTestApp(t, nil)
+	startsAt := time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC)
+	event := mustCreateEvent(t, app, "Rehearsal", startsAt)
+	other := mustCreateEvent(t, app, "Concert", startsAt)
+
+	ctx := context.Background()
+
+	att := &Attachment{EventID: event.ID, Filename: "scores.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}
+	if err := app.eventService.CreateAttachment(ctx, att); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+
+	if code, _ := c.do(http.MethodDelete, fmt.Sprintf("/%d/attachments/%d", other.ID, att.ID), nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleting through another event: got status %d, want %d", code, http.StatusNotFound)
+	}
+	if _, err := app.eventService.FindAttachmentByID(ctx, att.ID); err != nil {
+		t.Fatalf("the attachment should be kept: %v", err)
+	}
+
+	if code, _ := c.do(http.MethodDelete, fmt.Sprintf("/%d/attachments/%d", event.ID, att.ID), nil, nil); code != http.StatusSeeOther {
+		t.Errorf("deleting through its event: got status %d, want %d", code, http.StatusSeeOther)
+	}
+	if _, err := app.eventService.FindAttachmentByID(ctx, att.ID); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got %v after deletion, want %v", err, ErrNoRecord)
+	}
+
+	if code, _ := c.do(http.MethodDelete, fmt.Sprintf("/%d/attachments/%d", event.ID, att.ID), nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleting it again: got status %d, want %d", code, http.StatusNotFound)
+	}
+}
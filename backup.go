@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lobre/bow"
+)
+
+// backupVersion is the version of the backup format,
+// to be increased when it changes in an incompatible way.
+const backupVersion = 1
+
+// maxBackupSize is the maximum size of an imported backup.
+const maxBackupSize = 50 << 20
+
+// backup is a full copy of the schedule, made of the statuses, the guests,
+// the events and the participations. Rows keep their ids, so that
+// references between them survive a restore.
+type backup struct {
+	Version        int                   `json:"version"`
+	Statuses       []backupStatus        `json:"statuses"`
+	Guests         []backupGuest         `json:"guests"`
+	Events         []backupEvent         `json:"events"`
+	Participations []backupParticipation `json:"participations"`
+}
+
+type backupStatus struct {
+	ID          int     `json:"id"`
+	Label       string  `json:"label"`
+	Color       string  `json:"color"`
+	Description *string `json:"description"`
+	Icon        *string `json:"icon"`
+}
+
+type backupGuest struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Email     string  `json:"email"`
+	FeedToken *string `json:"feed_token"`
+	LinkToken *string `json:"link_token"`
+	Theme     string  `json:"theme"`
+}
+
+type backupEvent struct {
+	ID              int        `json:"id"`
+	Title           string     `json:"title"`
+	StartsAt        time.Time  `json:"starts_at"`
+	EndsAt          *time.Time `json:"ends_at"`
+	AllDay          bool       `json:"all_day"`
+	Description     *string    `json:"description"`
+	StatusID        *int64     `json:"status_id"`
+	CreatedAt       *time.Time `json:"created_at"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+	ResponsesOpenAt *time.Time `json:"responses_open_at"`
+	CancelledAt     *time.Time `json:"cancelled_at"`
+	DefaultNo       bool       `json:"default_no"`
+	MinAttendees    *int64     `json:"min_attendees"`
+	MaxAttendees    *int64     `json:"max_attendees"`
+	CreatedByID     *int64     `json:"created_by_id"`
+}
+
+type backupParticipation struct {
+	GuestID int    `json:"guest_id"`
+	EventID int    `json:"event_id"`
+	Attend  *int64 `json:"attend"`
+}
+
+// BackupService exports and restores the whole schedule.
+type BackupService struct {
+	db *bow.DB
+}
+
+// Export writes the whole schedule to w as a JSON backup, while reading
+// it in a single transaction so that the backup is consistent. Rows are
+// written as they are read, so that large schedules are not held in
+// memory, which also means that an error can stop a partly written backup.
+func (s *BackupService) Export(ctx context.Context, w io.Writer) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return exportBackup(ctx, tx, w)
+	})
+}
+
+// Import restores a backup in a single transaction. It returns
+// ErrNotEmpty if the database already contains statuses, guests
+// or events, unless force is set, in which case they are deleted
+// first. Admins and settings are kept.
+func (s *BackupService) Import(ctx context.Context, b *backup, force bool) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var n int
+		err := tx.QueryRowContext(ctx,
+			`SELECT (SELECT COUNT(*) FROM statuses) + (SELECT COUNT(*) FROM guests) + (SELECT COUNT(*) FROM events)`,
+		).Scan(&n)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 && !force {
+			return ErrNotEmpty
+		}
+
+		// participations and the other details of events are cascaded
+		for _, table := range []string{"events", "statuses", "guests"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table); err != nil {
+				return err
+			}
+		}
+
+		return importBackup(ctx, tx, b)
+	})
+}
+
+// validate checks the version of the backup and that its rows
+// only reference rows that are part of it.
+func (b *backup) validate() error {
+	if b.Version != backupVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, b.Version)
+	}
+
+	statuses := make(map[int]bool)
+	for _, status := range b.Statuses {
+		if statuses[status.ID] {
+			return fmt.Errorf("%w: duplicate status %d", ErrInvalidBackup, status.ID)
+		}
+		if !colorRX.MatchString(status.Color) {
+			return fmt.Errorf("%w: status %d: invalid color %q", ErrInvalidBackup, status.ID, status.Color)
+		}
+		statuses[status.ID] = true
+	}
+
+	guests := make(map[int]bool)
+	for _, guest := range b.Guests {
+		if guests[guest.ID] {
+			return fmt.Errorf("%w: duplicate guest %d", ErrInvalidBackup, guest.ID)
+		}
+		guests[guest.ID] = true
+	}
+
+	events := make(map[int]bool)
+	for _, event := range b.Events {
+		if events[event.ID] {
+			return fmt.Errorf("%w: duplicate event %d", ErrInvalidBackup, event.ID)
+		}
+		if event.StatusID != nil && !statuses[int(*event.StatusID)] {
+			return fmt.Errorf("%w: event %d: unknown status %d", ErrInvalidBackup, event.ID, *event.StatusID)
+		}
+		if event.CreatedByID != nil && !guests[int(*event.CreatedByID)] {
+			return fmt.Errorf("%w: event %d: unknown guest %d", ErrInvalidBackup, event.ID, *event.CreatedByID)
+		}
+		events[event.ID] = true
+	}
+
+	for _, part := range b.Participations {
+		if !guests[part.GuestID] || !events[part.EventID] {
+			return fmt.Errorf("%w: participation of guest %d to event %d: unknown guest or event", ErrInvalidBackup, part.GuestID, part.EventID)
+		}
+	}
+
+	return nil
+}
+
+// backupWriter writes a backup list by list, with the keys of the backup
+// type, so that it can be read back as one. The first error is kept and
+// stops the following writes.
+type backupWriter struct {
+	w   io.Writer
+	n   int // items written in the current list
+	err error
+}
+
+func (bw *backupWriter) write(s string) {
+	if bw.err == nil {
+		_, bw.err = io.WriteString(bw.w, s)
+	}
+}
+
+func (bw *backupWriter) startList(key string) {
+	bw.write(fmt.Sprintf(`,%q:[`, key))
+	bw.n = 0
+}
+
+func (bw *backupWriter) item(v interface{}) error {
+	if bw.err != nil {
+		return bw.err
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		bw.err = err
+		return err
+	}
+
+	if bw.n > 0 {
+		bw.write(",")
+	}
+	bw.write(string(b))
+	bw.n++
+
+	return bw.err
+}
+
+func (bw *backupWriter) endList() {
+	bw.write("]")
+}
+
+func exportBackup(ctx context.Context, tx *sql.Tx, w io.Writer) error {
+	bw := &backupWriter{w: w}
+	bw.write(fmt.Sprintf(`{"version":%d`, backupVersion))
+
+	statuses, _, err := findStatuses(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	bw.startList("statuses")
+	for _, status := range statuses {
+		err := bw.item(backupStatus{
+			ID:          status.ID,
+			Label:       status.Label,
+			Color:       status.Color,
+			Description: nullString(status.Description),
+			Icon:        nullString(status.Icon),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	bw.endList()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, name, email, feed_token, link_token, theme FROM guests ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bw.startList("guests")
+	for rows.Next() {
+		var guest backupGuest
+		var feedToken, linkToken sql.NullString
+
+		if err := rows.Scan(&guest.ID, &guest.Name, &guest.Email, &feedToken, &linkToken, &guest.Theme); err != nil {
+			return err
+		}
+		guest.FeedToken = nullString(feedToken)
+		guest.LinkToken = nullString(linkToken)
+
+		if err := bw.item(guest); err != nil {
+			return err
+		}
+	}
+	bw.endList()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	events, _, err := findEvents(ctx, tx, EventFilter{})
+	if err != nil {
+		return err
+	}
+
+	bw.startList("events")
+	for _, event := range events {
+		err := bw.item(backupEvent{
+			ID:              event.ID,
+			Title:           event.Title,
+			StartsAt:        event.StartsAt,
+			EndsAt:          nullTime(event.EndsAt),
+			AllDay:          event.AllDay,
+			Description:     nullString(event.Description),
+			StatusID:        nullInt(event.StatusID),
+			CreatedAt:       nullTime(event.CreatedAt),
+			UpdatedAt:       nullTime(event.UpdatedAt),
+			ResponsesOpenAt: nullTime(event.ResponsesOpenAt),
+			CancelledAt:     nullTime(event.CancelledAt),
+			DefaultNo:       event.DefaultNo,
+			MinAttendees:    nullInt(event.MinAttendees),
+			MaxAttendees:    nullInt(event.MaxAttendees),
+			CreatedByID:     nullInt(event.CreatedByID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	bw.endList()
+
+	rows, err = tx.QueryContext(ctx, `SELECT guest_id, event_id, attend FROM participations ORDER BY event_id, guest_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bw.startList("participations")
+	for rows.Next() {
+		var part backupParticipation
+		var attend sql.NullInt64
+
+		if err := rows.Scan(&part.GuestID, &part.EventID, &attend); err != nil {
+			return err
+		}
+		part.Attend = nullInt(attend)
+
+		if err := bw.item(part); err != nil {
+			return err
+		}
+	}
+	bw.endList()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	bw.write("}\n")
+
+	return bw.err
+}
+
+// importBackup inserts the rows of the backup keeping their ids,
+// referenced rows first.
+func importBackup(ctx context.Context, tx *sql.Tx, b *backup) error {
+	for _, status := range b.Statuses {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO statuses (id, label, color, description, icon) VALUES (?, ?, ?, ?, ?)`,
+			status.ID, status.Label, status.Color, status.Description, status.Icon,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, guest := range b.Guests {
+		theme := Themes[0]
+		for _, t := range Themes {
+			if t == guest.Theme {
+				theme = t
+			}
+		}
+
+		// tokens missing from older backups are generated
+		feedToken, err := tokenOrNew(guest.FeedToken)
+		if err != nil {
+			return err
+		}
+
+		linkToken, err := tokenOrNew(guest.LinkToken)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO guests (id, name, email, feed_token, link_token, theme) VALUES (?, ?, ?, ?, ?, ?)`,
+			guest.ID, guest.Name, guest.Email, feedToken, linkToken, theme,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, event := range b.Events {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO events (
+				id,
+				title,
+				starts_at,
+				ends_at,
+				all_day,
+				description,
+				status,
+				created_at,
+				updated_at,
+				responses_open_at,
+				cancelled_at,
+				default_no,
+				min_attendees,
+				max_attendees,
+				created_by
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			event.ID,
+			event.Title,
+			event.StartsAt,
+			event.EndsAt,
+			event.AllDay,
+			event.Description,
+			event.StatusID,
+			event.CreatedAt,
+			event.UpdatedAt,
+			event.ResponsesOpenAt,
+			event.CancelledAt,
+			event.DefaultNo,
+			event.MinAttendees,
+			event.MaxAttendees,
+			event.CreatedByID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, part := range b.Participations {
+		var attend sql.NullInt64
+		if part.Attend != nil {
+			attend = sql.NullInt64{Int64: *part.Attend, Valid: true}
+		}
+
+		err := upsertParticipation(ctx, tx, &Participation{GuestID: part.GuestID, EventID: part.EventID, Attend: attend})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tokenOrNew returns the given token, or a new one if it is nil.
+func tokenOrNew(token *string) (string, error) {
+	if token != nil {
+		return *token, nil
+	}
+	return generateToken()
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullInt(i sql.NullInt64) *int64 {
+	if !i.Valid {
+		return nil
+	}
+	return &i.Int64
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExportBackupRoundTrip(t *testing.T) {
+	app := newTestApp(t, nil)
+	ctx := context.Background()
+
+	status := mustCreateStatus(t, app, "Confirmed")
+	alice := mustCreateGuest(t, app, "Alice")
+	mustCreateGuest(t, app, "Bob")
+
+	event := &Event{
+		Title:    "Rehearsal",
+		StartsAt: time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC),
+		StatusID: sql.NullInt64{Int64: int64(status.ID), Valid: true},
+	}
+	if err := app.eventService.CreateEvent(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	part := &Participation{EventID: event.ID, GuestID: alice.ID, Attend: sql.NullInt64{Int64: AttendYes, Valid: true}}
+	if _, err := app.eventService.Participate(ctx, part); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+
+	code, body := c.do(http.MethodGet, "/export.json", nil, nil)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+
+	var b backup
+	if err := json.Unmarshal([]byte(body), &b); err != nil {
+		t.Fatalf("the backup is not valid json: %v: %s", err, body)
+	}
+
+	if b.Version != backupVersion {
+		t.Errorf("got version %d, want %d", b.Version, backupVersion)
+	}
+	if len(b.Statuses) != 1 || len(b.Guests) != 2 || len(b.Events) != 1 || len(b.Participations) != 1 {
+		t.Fatalf("got %d statuses, %d guests, %d events and %d participations, want 1, 2, 1 and 1",
+			len(b.Statuses), len(b.Guests), len(b.Events), len(b.Participations))
+	}
+
+	restored := newTestApp(t, nil)
+	if err := restored.backupService.Import(ctx, &b, false); err != nil {
+		t.Fatalf("importing the export: %v", err)
+	}
+
+	got, err := restored.eventService.FindEventByID(ctx, event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != event.Title || !got.StartsAt.Equal(event.StartsAt) || got.Status == nil || got.Status.Label != "Confirmed" {
+		t.Errorf("got restored event %+v, want %+v", got, event)
+	}
+
+	var answered int
+	for _, p := range got.Participations {
+		if p.Attend.Valid {
+			answered++
+			if p.GuestID != alice.ID || p.Attend.Int64 != AttendYes {
+				t.Errorf("got restored participation %+v, want %+v", p, part)
+			}
+		}
+	}
+	if answered != 1 {
+		t.Errorf("got %d restored answers, want 1", answered)
+	}
+}
+
+// failingWriter fails once more than n bytes are written.
+type failingWriter struct {
+	n int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		return 0, errWriteFailed
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestExportBackupWriteError(t *testing.T) {
+	app := newTestApp(t, nil)
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		mustCreateGuest(t, app, name)
+	}
+
+	err := app.backupService.Export(context.Background(), &failingWriter{n: 64})
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("got %v, want %v", err, errWriteFailed)
+	}
+}
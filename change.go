@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// EventChange is the change of a single field of an event.
+// The values are null when the field was or became empty.
+type EventChange struct {
+	Field    string
+	OldValue sql.NullString
+	NewValue sql.NullString
+}
+
+// EventEdit groups the changes made by a single update of an event.
+// Actor is the name of who made the update, if known.
+type EventEdit struct {
+	Actor     sql.NullString
+	ChangedAt time.Time
+	Changes   []*EventChange
+}
+
+// eventValues returns the values of the fields of an event that are tracked
+// in its history, as text keyed by the name of the field. Custom fields
+// are keyed by their own name. Empty fields are left out.
+func eventValues(ctx context.Context, tx *sql.Tx, evt *Event, fields map[string]string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for key, value := range fields {
+		values[key] = value
+	}
+
+	values["Title"] = evt.Title
+	values["Starts"] = evt.StartsAt.Format(layoutDatetime)
+
+	values["All day"] = "no"
+	if evt.AllDay {
+		values["All day"] = "yes"
+	}
+
+	values["No answer means no"] = "no"
+	if evt.DefaultNo {
+		values["No answer means no"] = "yes"
+	}
+
+	values["Cancelled"] = "no"
+	if evt.Cancelled() {
+		values["Cancelled"] = "yes"
+	}
+
+	if evt.EndsAt.Valid {
+		values["Ends"] = evt.EndsAt.Time.Format(layoutDatetime)
+	}
+
+	if evt.Description.Valid {
+		values["Description"] = evt.Description.String
+	}
+
+	if evt.MinAttendees.Valid {
+		values["Minimum attendees"] = strconv.FormatInt(evt.MinAttendees.Int64, 10)
+	}
+
+	if evt.MaxAttendees.Valid {
+		values["Maximum attendees"] = strconv.FormatInt(evt.MaxAttendees.Int64, 10)
+	}
+
+	if evt.ResponsesOpenAt.Valid {
+		values["Responses open"] = evt.ResponsesOpenAt.Time.Format(layoutDate)
+	}
+
+	if evt.StatusID.Valid {
+		status, err := findStatusByID(ctx, tx, int(evt.StatusID.Int64))
+		if err != nil {
+			return nil, err
+		}
+		values["Status"] = status.Label
+	}
+
+	return values, nil
+}
+
+// recordChanges stores the fields whose values differ between before and after
+// as a single edit of the event. Nothing is stored if no field has changed.
+func recordChanges(ctx context.Context, tx *sql.Tx, eventID int, before, after map[string]string, actor string, at time.Time) error {
+	keys := make(map[string]bool)
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+
+	var fields []string
+	for key := range keys {
+		oldValue, hadOld := before[key]
+		newValue, hasNew := after[key]
+		if hadOld != hasNew || oldValue != newValue {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		oldValue, hadOld := before[field]
+		newValue, hasNew := after[field]
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO event_changes (event_id, field, old_value, new_value, actor, changed_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			eventID,
+			field,
+			sql.NullString{String: oldValue, Valid: hadOld},
+			sql.NullString{String: newValue, Valid: hasNew},
+			sql.NullString{String: actor, Valid: actor != ""},
+			at,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findEditsByEvent fetches the history of an event from the newest edit to the oldest.
+// Changes recorded at the same time by the same actor belong to the same edit.
+func findEditsByEvent(ctx context.Context, tx *sql.Tx, id int) ([]*EventEdit, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT
+			field,
+			old_value,
+			new_value,
+			actor,
+			changed_at
+		FROM event_changes
+		WHERE event_id = ?
+		ORDER BY changed_at DESC, id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := make([]*EventEdit, 0)
+
+	for rows.Next() {
+		var change EventChange
+		var actor sql.NullString
+		var changedAt time.Time
+
+		err = rows.Scan(&change.Field, &change.OldValue, &change.NewValue, &actor, &changedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if n := len(edits); n == 0 || !edits[n-1].ChangedAt.Equal(changedAt) || edits[n-1].Actor != actor {
+			edits = append(edits, &EventEdit{Actor: actor, ChangedAt: changedAt})
+		}
+
+		last := edits[len(edits)-1]
+		last.Changes = append(last.Changes, &change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return edits, nil
+}
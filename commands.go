@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+const commandsUsage = `Commands:
+  admin add <username>      create an admin account, reading its password from stdin
+  guest add <name> <email>  create a guest
+
+Without command, the web server is started.
+`
+
+// runCommand runs a command given on the command line instead of starting
+// the web server. It allows to bootstrap accounts without the web interface.
+func (app *application) runCommand(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) < 2 || args[1] != "add" {
+		return fmt.Errorf("unknown command %q\n\n%s", strings.Join(args, " "), commandsUsage)
+	}
+
+	switch args[0] {
+	case "admin":
+		if len(args) != 3 {
+			return errors.New("usage: admin add <username>")
+		}
+		return app.addAdmin(ctx, args[2], stdin, stdout)
+
+	case "guest":
+		if len(args) != 4 {
+			return errors.New("usage: guest add <name> <email>")
+		}
+		return app.addGuest(ctx, args[2], args[3], stdout)
+	}
+
+	return fmt.Errorf("unknown command %q\n\n%s", strings.Join(args, " "), commandsUsage)
+}
+
+func (app *application) addAdmin(ctx context.Context, username string, stdin io.Reader, stdout io.Writer) error {
+	username = strings.TrimSpace(username)
+	if username == "" || utf8.RuneCountInString(username) > maxUsernameLength {
+		return fmt.Errorf("the username must have between 1 and %d characters", maxUsernameLength)
+	}
+
+	fmt.Fprint(stdout, "Password: ")
+
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	fmt.Fprintln(stdout)
+
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("the password must have at least %d characters", minPasswordLength)
+	}
+
+	admin := Admin{Username: username}
+
+	err = app.adminService.CreateAdmin(ctx, &admin, password)
+	if errors.Is(err, ErrDuplicateUsername) {
+		return fmt.Errorf("the admin %s already exists", username)
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Admin %s created\n", admin.Username)
+	return nil
+}
+
+func (app *application) addGuest(ctx context.Context, name, email string, stdout io.Writer) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("the name cannot be blank")
+	}
+
+	if _, err := mail.ParseAddress(email); err != nil {
+		return fmt.Errorf("%s is not a valid email", email)
+	}
+
+	guest := Guest{Name: name, Email: email}
+
+	err := app.guestService.CreateGuest(ctx, &guest)
+	if errors.Is(err, ErrDuplicateEmail) {
+		return fmt.Errorf("a guest with the email %s already exists", email)
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Guest %s created with id %d\n", guest.Name, guest.ID)
+	return nil
+}
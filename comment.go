@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lobre/bow"
+)
+
+// maxCommentLength is the maximum number of characters of a comment.
+const maxCommentLength = 2000
+
+type Comment struct {
+	ID        int
+	EventID   int
+	Body      string
+	CreatedAt time.Time
+
+	GuestID int
+	Guest   *Guest
+}
+
+type CommentService struct {
+	db *bow.DB
+}
+
+func (s *CommentService) FindCommentByID(ctx context.Context, id int) (comment *Comment, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		comment, err = findCommentByID(ctx, tx, id)
+		return err
+	})
+
+	return comment, err
+}
+
+func (s *CommentService) FindCommentsByEvent(ctx context.Context, id int) (comments []*Comment, n int, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		comments, n, err = findCommentsByEvent(ctx, tx, id)
+		return err
+	})
+
+	return comments, n, err
+}
+
+// CreateComment creates a comment and attaches its author.
+func (s *CommentService) CreateComment(ctx context.Context, comment *Comment) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		err := createComment(ctx, tx, comment)
+		if err != nil {
+			return err
+		}
+
+		comment.Guest, err = findGuestByID(ctx, tx, comment.GuestID)
+		return err
+	})
+}
+
+func (s *CommentService) DeleteComment(ctx context.Context, id int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return deleteComment(ctx, tx, id)
+	})
+}
+
+// findCommentsByEvent fetches the comments of an event from the oldest to the newest.
+// For each comment, the author is attached.
+func findCommentsByEvent(ctx context.Context, tx *sql.Tx, id int) (_ []*Comment, n int, err error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT
+			id,
+			event_id,
+			guest_id,
+			body,
+			created_at,
+			COUNT(*) OVER()
+		FROM comments
+		WHERE event_id = ?
+		ORDER BY created_at, id`,
+		id,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	comments := make([]*Comment, 0)
+
+	for rows.Next() {
+		var comment Comment
+
+		err = rows.Scan(&comment.ID, &comment.EventID, &comment.GuestID, &comment.Body, &comment.CreatedAt, &n)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// attach guest
+		comment.Guest, err = findGuestByID(ctx, tx, comment.GuestID)
+		if err != nil {
+			if errors.Is(err, ErrNoRecord) {
+				// guest has been removed, skip
+				continue
+			}
+			return nil, 0, err
+		}
+
+		comments = append(comments, &comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return comments, n, nil
+}
+
+func findCommentByID(ctx context.Context, tx *sql.Tx, id int) (*Comment, error) {
+	row := tx.QueryRowContext(ctx, `SELECT id, event_id, guest_id, body, created_at FROM comments WHERE id = ?`, id)
+
+	var comment Comment
+	err := row.Scan(&comment.ID, &comment.EventID, &comment.GuestID, &comment.Body, &comment.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func createComment(ctx context.Context, tx *sql.Tx, comment *Comment) error {
+	comment.Body = sanitizeComment(comment.Body)
+	comment.CreatedAt = time.Now().UTC()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO comments (event_id, guest_id, body, created_at) VALUES (?, ?, ?, ?)`,
+		comment.EventID,
+		comment.GuestID,
+		comment.Body,
+		comment.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	comment.ID = int(id)
+
+	return nil
+}
+
+func deleteComment(ctx context.Context, tx *sql.Tx, id int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sanitizeComment normalizes line endings, removes control characters
+// and trims surrounding spaces. Comments are stored as plain text and
+// are escaped when rendered.
+func sanitizeComment(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && (r < 0x20 || r == 0x7f) {
+			return -1
+		}
+		return r
+	}, body)
+	return strings.TrimSpace(body)
+}
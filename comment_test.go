@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCreateCommentOnMissingEvent(t *testing.T) {
+	app := newTestApp(t, nil)
+	guest := mustCreateGuest(t, app, "Alice")
+	event := mustCreateEvent(t, app, "Rehearsal", time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC))
+
+	c := newTestClient(t, app).asGuest(guest.ID)
+	form := url.Values{"body": {"See you there"}}
+
+	if code, _ := c.do(http.MethodPost, fmt.Sprintf("/%d/comments", event.ID+1), form, nil); code != http.StatusNotFound {
+		t.Errorf("commenting a missing event: got status %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code, _ := c.do(http.MethodPost, fmt.Sprintf("/%d/comments", event.ID), form, nil); code != http.StatusSeeOther {
+		t.Errorf("commenting an event: got status %d, want %d", code, http.StatusSeeOther)
+	}
+
+	for id, want := range map[int]int{event.ID: 1, event.ID + 1: 0} {
+		if _, n, err := app.commentService.FindCommentsByEvent(context.Background(), id); err != nil {
+			t.Fatal(err)
+		} else if n != want {
+			t.Errorf("got %d comments on event %d, want %d", n, id, want)
+		}
+	}
+}
+
+func TestDeleteCommentOfAnotherEvent(t *testing.T) {
+	app := newTestApp(t, nil)
+	guest := mustCreateGuest(t, app, "Alice")
+	startsAt := time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC)
+	event := mustCreateEvent(t, app, "Rehearsal", startsAt)
+	other := mustCreateEvent(t, app, "Concert", startsAt)
+
+	ctx := context.Background()
+
+	comment := &Comment{EventID: event.ID, GuestID: guest.ID, Body: "See you there"}
+	if err := app.commentService.CreateComment(ctx, comment); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, app).asGuest(guest.ID)
+
+	if code, _ := c.do(http.MethodDelete, fmt.Sprintf("/%d/comments/%d", other.ID, comment.ID), nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleting through another event: got status %d, want %d", code, http.StatusNotFound)
+	}
+	if _, err := app.commentService.FindCommentByID(ctx, comment.ID); err != nil {
+		t.Fatalf("the comment should be kept: %v", err)
+	}
+
+	if code, _ := c.do(http.MethodDelete, fmt.Sprintf("/%d/comments/%d", event.ID, comment.ID), nil, nil); code != http.StatusSeeOther {
+		t.Errorf("deleting through its event: got status %d, want %d", code, http.StatusSeeOther)
+	}
+	if _, err := app.commentService.FindCommentByID(ctx, comment.ID); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("got %v after deletion, want %v", err, ErrNoRecord)
+	}
+}
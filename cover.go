@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+const (
+	// maxCoverSize is the maximum size in bytes of a cover image.
+	maxCoverSize = 2 << 20
+
+	// maxCoverDimension is the maximum width and height in pixels of a cover image.
+	maxCoverDimension = 2048
+)
+
+// coverTypes maps the content types allowed for
+// cover images to their file extension.
+var coverTypes = map[string]string{
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// Cover is the image illustrating an event. An event has at most one cover.
+type Cover struct {
+	EventID     int
+	ContentType string
+	Data        []byte
+
+	// Name is a filename containing the hash of the data,
+	// so that the cover can be cached forever by browsers.
+	Name string
+}
+
+// newCover builds the cover of an event from the given image data.
+// It returns ErrInvalidImage if the data is not an allowed image
+// or if the image is too large.
+func newCover(eventID int, contentType string, data []byte) (*Cover, error) {
+	ext, ok := coverTypes[contentType]
+	if !ok {
+		return nil, ErrInvalidImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	if cfg.Width > maxCoverDimension || cfg.Height > maxCoverDimension {
+		return nil, ErrInvalidImage
+	}
+
+	sum := sha256.Sum256(data)
+
+	return &Cover{
+		EventID:     eventID,
+		ContentType: contentType,
+		Data:        data,
+		Name:        hashfs.FormatName("cover"+ext, hex.EncodeToString(sum[:])),
+	}, nil
+}
+
+func (s *EventService) FindCoverByEvent(ctx context.Context, id int) (cover *Cover, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		cover, err = findCoverByEvent(ctx, tx, id)
+		return err
+	})
+
+	return cover, err
+}
+
+// SetCover sets the cover of an event, replacing the previous one if any.
+func (s *EventService) SetCover(ctx context.Context, cover *Cover) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return setCover(ctx, tx, cover)
+	})
+}
+
+func (s *EventService) DeleteCover(ctx context.Context, id int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return deleteCover(ctx, tx, id)
+	})
+}
+
+func findCoverByEvent(ctx context.Context, tx *sql.Tx, id int) (*Cover, error) {
+	row := tx.QueryRowContext(ctx, `SELECT event_id, name, content_type, data FROM event_covers WHERE event_id = ?`, id)
+
+	var cover Cover
+	err := row.Scan(&cover.EventID, &cover.Name, &cover.ContentType, &cover.Data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return &cover, nil
+}
+
+func setCover(ctx context.Context, tx *sql.Tx, cover *Cover) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT OR REPLACE INTO event_covers (event_id, name, content_type, data) VALUES (?, ?, ?, ?)`,
+		cover.EventID,
+		cover.Name,
+		cover.ContentType,
+		cover.Data,
+	)
+	return err
+}
+
+func deleteCover(ctx context.Context, tx *sql.Tx, id int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM event_covers WHERE event_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lobre/bow"
+)
+
+// schemaTables lists the tables that must exist once migrations have run.
+var schemaTables = []string{
+	"migrations",
+	"statuses",
+	"events",
+	"guests",
+	"participations",
+	"event_attachments",
+	"comments",
+	"settings",
+	"event_covers",
+	"event_fields",
+	"admins",
+	"event_changes",
+	"rsvp_tokens",
+}
+
+// errDryRun is returned by the functions given to withTx
+// to roll back changes that are only previewed.
+var errDryRun = errors.New("dry run")
+
+// withTx runs fn inside a transaction. The transaction is committed
+// when fn returns no error and rolled back otherwise.
+func withTx(ctx context.Context, db *bow.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withForeignKeys adds the parameter enforcing foreign keys to the given
+// data source name. The core enables them with a pragma, which only applies
+// to the first connection of the pool, so deletions were not always cascaded.
+func withForeignKeys(dsn string) string {
+	if dsn == ":memory:" || strings.Contains(dsn, "_foreign_keys=") || strings.Contains(dsn, "_fk=") {
+		return dsn
+	}
+
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=1"
+	}
+	return dsn + "?_foreign_keys=1"
+}
+
+// checkDSN makes sure the database file of the given data source name
+// can be opened, creating its parent directory if needed. It returns
+// a clearer error than the one of the driver when the path is
+// a directory or when the file is not readable.
+func checkDSN(dsn string) error {
+	path := strings.TrimPrefix(dsn, "file:")
+	if i := strings.Index(path, "?"); i != -1 {
+		path = path[:i]
+	}
+
+	if path == "" || path == ":memory:" {
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("cannot open database at %s: %w", path, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot open database at %s: %w", path, err)
+	}
+
+	if fi.IsDir() {
+		return fmt.Errorf("cannot open database at %s: is a directory", path)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("cannot open database at %s: %w", path, err)
+	}
+
+	return f.Close()
+}
+
+// pingTimeout bounds the time waited for the database at startup.
+const pingTimeout = 5 * time.Second
+
+// pingDB makes sure the database answers a query within pingTimeout,
+// so that an unusable database fails at startup instead of on the
+// first requests. The core has no ping, so a transaction is used.
+func pingDB(ctx context.Context, db *bow.DB, dsn string) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	err := withTx(ctx, db, func(tx *sql.Tx) error {
+		var one int
+		return tx.QueryRowContext(ctx, `SELECT 1`).Scan(&one)
+	})
+	if err != nil {
+		return fmt.Errorf("database at %s is not reachable: %w", dsn, err)
+	}
+
+	return nil
+}
+
+// checkSchema makes sure all the expected tables exist,
+// so that a damaged database fails at startup.
+func checkSchema(ctx context.Context, db *bow.DB) error {
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		var missing []string
+
+		for _, table := range schemaTables {
+			var n int
+			err := tx.QueryRowContext(ctx,
+				`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table,
+			).Scan(&n)
+			if err != nil {
+				return err
+			}
+
+			if n == 0 {
+				missing = append(missing, table)
+			}
+		}
+
+		if len(missing) > 0 {
+			return fmt.Errorf("database schema is incomplete, missing tables: %s", strings.Join(missing, ", "))
+		}
+
+		return nil
+	})
+}
@@ -19,18 +19,158 @@ type Event struct {
 	EndsAt      sql.NullTime
 	Description sql.NullString
 
-	StatusID int
+	// AllDay events have no meaningful time. They start at midnight
+	// and, when they have an end, it is the midnight of their last day.
+	AllDay bool
+
+	// StatusID is null for events without a status,
+	// in which case Status is nil.
+	StatusID sql.NullInt64
 	Status   *Status
 
-	// This is only set when returning a single event.
+	CreatedAt sql.NullTime
+	UpdatedAt sql.NullTime
+
+	// CreatedByID is the guest who created the event. It is null for
+	// events created before it was recorded or without being recognized.
+	// CreatedByName is only set when reading events.
+	CreatedByID   sql.NullInt64
+	CreatedByName sql.NullString
+
+	// ResponsesOpenAt is when guests can start responding.
+	// If null, they can respond as soon as the event is created.
+	ResponsesOpenAt sql.NullTime
+
+	// CancelledAt is when the event has been cancelled. Cancelled
+	// events are still displayed but don’t accept responses.
+	CancelledAt sql.NullTime
+
+	// DefaultNo counts the guests who haven’t answered
+	// as not attending once responses are closed.
+	DefaultNo bool
+
+	// MinAttendees is how many guests are needed for the event to take place,
+	// and MaxAttendees how many it can welcome. Both are informative only:
+	// guests can still respond once they are reached.
+	MinAttendees sql.NullInt64
+	MaxAttendees sql.NullInt64
+
+	// CoverName is the hashed filename of the cover image, if any.
+	CoverName sql.NullString
+
+	// These are only set when returning a single event.
 	Participations []*Participation
+	Attachments    []*Attachment
+	Comments       []*Comment
+	Fields         map[string]string
+	Edits          []*EventEdit
+
+	// defaultDuration is used to compute the end of
+	// events that don’t have one.
+	defaultDuration time.Duration
+
+	// gracePeriod is how long the event stays active after its end.
+	gracePeriod time.Duration
+
+	// location is the time zone in which the event has been entered,
+	// and now tells the current time, time.Now when nil.
+	location *time.Location
+	now      func() time.Time
+
+	// ifNeeded tells how "if needed" responses are counted.
+	ifNeeded string
+
+	// extracted is the participation removed by ExtractParticipation,
+	// which is still counted by YesCount.
+	extracted *Participation
 }
 
-// Upcoming returns true if the event is in the future,
-// false otherwise.
+// EffectiveEndsAt returns the end of the event. If the event has no end,
+// it is computed from the start and the default duration. All day
+// events end at the end of their last day.
+func (evt *Event) EffectiveEndsAt() time.Time {
+	if evt.AllDay {
+		last := evt.StartsAt
+		if evt.EndsAt.Valid {
+			last = evt.EndsAt.Time
+		}
+		// all day events last until the end of their last day
+		y, m, d := last.Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, last.Location())
+	}
+
+	if evt.EndsAt.Valid {
+		return evt.EndsAt.Time
+	}
+	return evt.StartsAt.Add(evt.defaultDuration)
+}
+
+// Upcoming returns true if the event is not over yet, taking
+// the grace period into account, false otherwise.
 func (evt *Event) Upcoming() bool {
-	today := time.Now()
-	return evt.StartsAt.After(today)
+	return evt.EffectiveEndsAt().Add(evt.gracePeriod).After(wallClock(evt.now, evt.location))
+}
+
+// CoverURL returns the url of the cover image of the event.
+// It returns an empty string if the event has no cover.
+func (evt *Event) CoverURL() string {
+	if !evt.CoverName.Valid {
+		return ""
+	}
+	return fmt.Sprintf("/%d/cover/%s", evt.ID, evt.CoverName.String)
+}
+
+// ResponsesOpen returns true if the time to respond has come, false otherwise.
+func (evt *Event) ResponsesOpen() bool {
+	return !evt.ResponsesOpenAt.Valid || !evt.ResponsesOpenAt.Time.After(wallClock(evt.now, evt.location))
+}
+
+// Cancelled returns true if the event has been cancelled.
+func (evt *Event) Cancelled() bool {
+	return evt.CancelledAt.Valid
+}
+
+// PendingAsNo returns true if the guests who haven’t answered are counted as not
+// attending, which is the case once the event is over when DefaultNo is set.
+// It is computed when reading, so that changing the flag applies right away.
+func (evt *Event) PendingAsNo() bool {
+	return evt.DefaultNo && !evt.Upcoming()
+}
+
+// AcceptsResponses returns true if guests can currently respond to the event, which
+// requires responses to be open and the event to be upcoming and not cancelled.
+func (evt *Event) AcceptsResponses() bool {
+	return evt.ResponsesOpen() && evt.Upcoming() && !evt.Cancelled()
+}
+
+// LastModified returns the last time the event has been changed.
+// Events created before the tracking of modifications fall back
+// on their start date.
+func (evt *Event) LastModified() time.Time {
+	if evt.UpdatedAt.Valid {
+		return evt.UpdatedAt.Time
+	}
+	if evt.CreatedAt.Valid {
+		return evt.CreatedAt.Time
+	}
+	return evt.StartsAt
+}
+
+// YesCount returns the number of guests attending the event, counting
+// "if needed" responses as configured.
+func (evt *Event) YesCount() int {
+	parts := evt.Participations
+	if evt.extracted != nil {
+		parts = append([]*Participation{evt.extracted}, parts...)
+	}
+
+	var n int
+	for _, part := range parts {
+		if part.Attend.Valid && countedAttend(part.Attend.Int64, evt.ifNeeded) == AttendYes {
+			n++
+		}
+	}
+	return n
 }
 
 // ExtractParticipation extracts the participation of the given guest from an event.
@@ -43,6 +183,7 @@ func (evt *Event) ExtractParticipation(guest *Guest) *Participation {
 			guestPart = part
 			// remove from list
 			evt.Participations = append(evt.Participations[:i], evt.Participations[i+1:]...)
+			evt.extracted = part
 			break
 		}
 	}
@@ -50,11 +191,142 @@ func (evt *Event) ExtractParticipation(guest *Guest) *Participation {
 	return guestPart
 }
 
+// MinReached returns true if enough guests attend the event
+// for it to take place. It is false when there is no minimum.
+func (evt *Event) MinReached() bool {
+	return evt.MinAttendees.Valid && int64(evt.YesCount()) >= evt.MinAttendees.Int64
+}
+
+// Full returns true if the event welcomes as many
+// guests as it can. It is false when there is no maximum.
+func (evt *Event) Full() bool {
+	return evt.MaxAttendees.Valid && int64(evt.YesCount()) >= evt.MaxAttendees.Int64
+}
+
 type EventFilter struct {
 	ID      *int
 	IDNotIn []int
 	Title   *string
 	Past    *bool
+
+	// Cancelled keeps the cancelled events when true,
+	// and the ones taking place when false.
+	Cancelled *bool
+
+	// From and To keep the events whose time window,
+	// computed with their effective end, overlaps this one.
+	From *time.Time
+	To   *time.Time
+
+	// Order is the key of the column to sort events with.
+	// It should be one of the keys of EventOrders.
+	Order string
+
+	// Reverse inverts the sort direction, which is ascending
+	// for upcoming events and descending for past events.
+	Reverse bool
+
+	// Limit caps the number of returned events when positive,
+	// skipping the first Offset ones. The returned count still
+	// reflects all matching events.
+	Limit  int
+	Offset int
+
+	// These are set by the service to tell past events apart
+	// and to count attendance.
+	defaultDuration time.Duration
+	gracePeriod     time.Duration
+	ifNeeded        string
+	location        *time.Location
+	now             func() time.Time
+}
+
+// EventOrders maps the allowed sort keys of events to their SQL expression.
+// As the expression is interpolated in the query, the key should
+// always be checked against this list. The attendance expects whether
+// "if needed" responses are counted as yes as argument.
+var EventOrders = map[string]string{
+	"date":       "starts_at",
+	"title":      "title COLLATE NOCASE",
+	"status":     "(SELECT label FROM statuses WHERE statuses.id = events.status) COLLATE NOCASE",
+	"attendance": fmt.Sprintf("(SELECT COUNT(*) FROM participations WHERE participations.event_id = events.id AND (attend = %d OR (attend = %d AND ?)))", AttendYes, AttendIfNeeded),
+}
+
+// EventColumns are the optional columns of the list of events, in their
+// order of display. The date and the title are always displayed.
+var EventColumns = []string{"status", "participation", "attendance", "organizer"}
+
+// parseEventColumns parses a comma separated list of keys of EventColumns.
+func parseEventColumns(s string) (map[string]bool, error) {
+	columns := make(map[string]bool)
+
+	for _, key := range strings.Split(s, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		known := false
+		for _, column := range EventColumns {
+			known = known || column == key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q, should be one of %s", key, strings.Join(EventColumns, ", "))
+		}
+
+		columns[key] = true
+	}
+
+	return columns, nil
+}
+
+// EventScopes are the periods the list of events can be restricted to.
+var EventScopes = map[string]bool{
+	ScopeUpcoming: true,
+	ScopeWeek:     true,
+	ScopePast:     true,
+	ScopeAll:      true,
+}
+
+const (
+	ScopeUpcoming = "upcoming"
+	ScopeWeek     = "week"
+	ScopePast     = "past"
+	ScopeAll      = "all"
+)
+
+// currentWeek returns the bounds of the week of t, from monday to monday.
+func currentWeek(t time.Time) (from, to time.Time) {
+	y, m, d := t.Date()
+	offset := (int(t.Weekday()) + 6) % 7
+	from = time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 0, 7)
+}
+
+// effectiveEndsAtSQL is the SQL expression of the effective end of events.
+// It expects the default duration as a modifier argument.
+const effectiveEndsAtSQL = "datetime(CASE WHEN all_day THEN date(COALESCE(ends_at, starts_at), '+1 day') ELSE COALESCE(ends_at, datetime(starts_at, ?)) END)"
+
+// wallClock returns the time told by now in the given zone as a UTC time with the
+// same wall clock, which is how the dates of events are stored, as they are entered.
+// Comparing them with it tells whether they are past in that zone.
+// A nil now is time.Now, and a nil zone is UTC.
+func wallClock(now func() time.Time, loc *time.Location) time.Time {
+	if now == nil {
+		now = time.Now
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	t := now().In(loc)
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// sqlModifier turns a duration into an SQLite date modifier.
+func sqlModifier(d time.Duration) string {
+	return fmt.Sprintf("%+d seconds", int(d.Seconds()))
 }
 
 // EventUpdate represents a set of fields to be updated via UpdateEvent
@@ -62,34 +334,89 @@ type EventUpdate struct {
 	Title       *string
 	StartsAt    *time.Time
 	EndsAt      *sql.NullTime
+	AllDay      *bool
 	Description *sql.NullString
-	StatusID    *int
+	StatusID    *sql.NullInt64
+	Fields      *map[string]string
+
+	ResponsesOpenAt *sql.NullTime
+	CancelledAt     *sql.NullTime
+	DefaultNo       *bool
+	MinAttendees    *sql.NullInt64
+	MaxAttendees    *sql.NullInt64
+}
+
+// EventCounts summarizes the number of events.
+type EventCounts struct {
+	Total    int
+	Upcoming int
+	ByStatus []*StatusCount
+}
+
+// StatusCount is the number of events having a given status.
+type StatusCount struct {
+	Status *Status
+	N      int
 }
 
 type EventService struct {
 	db *bow.DB
+
+	// defaultDuration is the duration given to events with no end.
+	defaultDuration time.Duration
+
+	// gracePeriod is how long events stay active after their end.
+	gracePeriod time.Duration
+
+	// ifNeeded tells how "if needed" responses are
+	// counted when sorting events by attendance.
+	ifNeeded string
+
+	// location is the time zone in which
+	// the dates of events are entered.
+	location *time.Location
+
+	// now tells the current time, time.Now when nil.
+	// It is replaced by tests to simulate another time.
+	now func() time.Time
+}
+
+// configure applies the settings of the service to an event.
+func (s *EventService) configure(event *Event) {
+	event.defaultDuration = s.defaultDuration
+	event.gracePeriod = s.gracePeriod
+	event.ifNeeded = s.ifNeeded
+	event.location = s.location
+	event.now = s.now
 }
 
 // FindEventByID retrieves an event and attaches participations and status.
-func (s *EventService) FindEventByID(ctx context.Context, id int) (*Event, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+func (s *EventService) FindEventByID(ctx context.Context, id int) (event *Event, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		event, err = s.findEventDetails(ctx, tx, id)
+		return err
+	})
+
+	return event, err
+}
 
+// findEventDetails fetches an event with all its details within the given transaction.
+func (s *EventService) findEventDetails(ctx context.Context, tx *sql.Tx, id int) (*Event, error) {
 	event, err := findEventByID(ctx, tx, id)
 	if err != nil {
 		return nil, err
 	}
+	s.configure(event)
 
-	event.Status, err = findStatusByID(ctx, tx, event.StatusID)
-	if err != nil {
-		return nil, err
+	if event.StatusID.Valid {
+		event.Status, err = findStatusByID(ctx, tx, int(event.StatusID.Int64))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// attach participations for this event
-	event.Participations, _, err = findParticipationsByEvent(ctx, tx, event.ID)
+	event.Participations, _, err = findParticipations(ctx, tx, ParticipationFilter{EventID: &event.ID})
 	if err != nil {
 		return nil, err
 	}
@@ -101,104 +428,326 @@ func (s *EventService) FindEventByID(ctx context.Context, id int) (*Event, error
 
 	sort.Sort(ByGuestName(event.Participations))
 
-	return event, nil
-}
+	event.Attachments, _, err = findAttachmentsByEvent(ctx, tx, event.ID)
+	if err != nil {
+		return nil, err
+	}
 
-// FindEvents retrieves the list of events and attaches status for each of them.
-func (s *EventService) FindEvents(ctx context.Context, filter EventFilter) ([]*Event, int, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
+	event.Comments, _, err = findCommentsByEvent(ctx, tx, event.ID)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	defer tx.Rollback()
 
-	events, n, err := findEvents(ctx, tx, filter)
+	event.Fields, err = findFieldsByEvent(ctx, tx, event.ID)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// attach status
-	for _, event := range events {
-		event.Status, err = findStatusByID(ctx, tx, event.StatusID)
-		if err != nil {
-			return nil, 0, err
-		}
+	event.Edits, err = findEditsByEvent(ctx, tx, event.ID)
+	if err != nil {
+		return nil, err
+	}
 
-		// attach participations for this event
-		event.Participations, _, err = findParticipationsByEvent(ctx, tx, event.ID)
+	return event, nil
+}
+
+// FindEvents retrieves the list of events and attaches status for each of them.
+func (s *EventService) FindEvents(ctx context.Context, filter EventFilter) (events []*Event, n int, err error) {
+	filter.defaultDuration = s.defaultDuration
+	filter.gracePeriod = s.gracePeriod
+	filter.ifNeeded = s.ifNeeded
+	filter.location = s.location
+	filter.now = s.now
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		events, n, err = findEvents(ctx, tx, filter)
 		if err != nil {
-			return nil, 0, err
+			return err
 		}
 
-		// create participations with no value for unanswered guests
-		if err := attachUnansweredGuests(ctx, tx, event); err != nil {
-			return nil, 0, err
+		// attach status
+		for _, event := range events {
+			s.configure(event)
+
+			if event.StatusID.Valid {
+				event.Status, err = findStatusByID(ctx, tx, int(event.StatusID.Int64))
+				if err != nil {
+					return err
+				}
+			}
+
+			// attach participations for this event
+			event.Participations, _, err = findParticipations(ctx, tx, ParticipationFilter{EventID: &event.ID})
+			if err != nil {
+				return err
+			}
+
+			// create participations with no value for unanswered guests
+			if err := attachUnansweredGuests(ctx, tx, event); err != nil {
+				return err
+			}
+
+			sort.Sort(ByGuestName(event.Participations))
 		}
 
-		sort.Sort(ByGuestName(event.Participations))
-	}
+		return nil
+	})
 
-	return events, n, nil
+	return events, n, err
 }
 
-func (s *EventService) CreateEvent(ctx context.Context, event *Event) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
+// CountEvents returns how many events there are in total,
+// how many are upcoming and how many there are for each status.
+func (s *EventService) CountEvents(ctx context.Context) (counts *EventCounts, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		counts, err = countEvents(ctx, tx, s.defaultDuration, s.gracePeriod, wallClock(s.now, s.location))
 		return err
-	}
-	defer tx.Rollback()
+	})
 
-	err = createEvent(ctx, tx, event)
-	if err != nil {
+	return counts, err
+}
+
+// CountPending returns how many events still accept responses
+// while the given guest hasn’t answered them.
+func (s *EventService) CountPending(ctx context.Context, guestID int) (n int, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		n, err = countPendingEvents(ctx, tx, guestID, s.defaultDuration, s.gracePeriod, wallClock(s.now, s.location))
 		return err
-	}
+	})
 
-	return tx.Commit()
+	return n, err
+}
+
+func (s *EventService) CreateEvent(ctx context.Context, event *Event) error {
+	s.configure(event)
+
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return createEvent(ctx, tx, event)
+	})
 }
 
 func (s *EventService) DeleteEvent(ctx context.Context, id int) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return deleteEvent(ctx, tx, id)
+	})
+}
+
+// UpdateEvent updates an event and records the changed fields in its history.
+// The actor is the name of who makes the update, or empty if unknown.
+func (s *EventService) UpdateEvent(ctx context.Context, id int, upd EventUpdate, actor string) (event *Event, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		event, err = updateEvent(ctx, tx, id, upd, actor)
+		if err != nil {
+			return err
+		}
+		s.configure(event)
+
+		return nil
+	})
+
+	return event, err
+}
+
+// Participate records the answer of a guest to an event. It returns the event
+// as read in the same transaction, so that it reflects this very answer even
+// when the same guest answers several times in a row.
+func (s *EventService) Participate(ctx context.Context, part *Participation) (event *Event, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := upsertParticipation(ctx, tx, part); err != nil {
+			return err
+		}
+
+		event, err = s.findEventDetails(ctx, tx, part.EventID)
 		return err
+	})
+
+	return event, err
+}
+
+// FindOverlapping retrieves the other events taking place at the same time
+// as the given one. Events with no end last for the default duration.
+// Cancelled events are left out, as they won’t take place.
+func (s *EventService) FindOverlapping(ctx context.Context, event *Event) (events []*Event, err error) {
+	from, to := event.StartsAt, event.EffectiveEndsAt()
+	cancelled := false
+
+	filter := EventFilter{
+		IDNotIn:         []int{event.ID},
+		Cancelled:       &cancelled,
+		From:            &from,
+		To:              &to,
+		defaultDuration: s.defaultDuration,
 	}
-	defer tx.Rollback()
 
-	err = deleteEvent(ctx, tx, id)
-	if err != nil {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		events, _, err = findEvents(ctx, tx, filter)
 		return err
+	})
+
+	return events, err
+}
+
+// ClearParticipation removes the answer of a guest to an event.
+// It returns the event as read right after the change.
+func (s *EventService) ClearParticipation(ctx context.Context, eventID, guestID int) (event *Event, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := deleteParticipation(ctx, tx, eventID, guestID); err != nil {
+			return err
+		}
+
+		event, err = s.findEventDetails(ctx, tx, eventID)
+		return err
+	})
+
+	return event, err
+}
+
+// CleanParticipations deletes the participations left behind by removed
+// guests or events, which were not always cascaded. It returns the
+// participations that have been deleted. With dryRun, the transaction
+// is rolled back, so that the deletion can be previewed.
+func (s *EventService) CleanParticipations(ctx context.Context, dryRun bool) (parts []*Participation, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		parts, err = deleteOrphanParticipations(ctx, tx)
+		if err == nil && dryRun {
+			return errDryRun
+		}
+		return err
+	})
+
+	if errors.Is(err, errDryRun) {
+		err = nil
 	}
 
-	return tx.Commit()
+	return parts, err
 }
 
-func (s *EventService) UpdateEvent(ctx context.Context, id int, upd EventUpdate) (*Event, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
+// ParticipateAll records the participations of several guests to an event in a
+// single transaction. Only the participations that differ from the stored ones
+// are written, and the ones without answer are deleted. It returns the number
+// of participations that have been changed, ErrNoRecord if the event doesn’t
+// exist and ErrUnknownGuest if one of the guests doesn’t, changing nothing.
+func (s *EventService) ParticipateAll(ctx context.Context, eventID int, parts []*Participation) (n int, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := findEventByID(ctx, tx, eventID); err != nil {
+			return err
+		}
+
+		current, _, err := findParticipations(ctx, tx, ParticipationFilter{EventID: &eventID})
+		if err != nil {
+			return err
+		}
+
+		stored := make(map[int]sql.NullInt64)
+		for _, part := range current {
+			stored[part.GuestID] = part.Attend
+		}
+
+		for _, part := range parts {
+			part.EventID = eventID
+
+			if _, err := findGuestByID(ctx, tx, part.GuestID); errors.Is(err, ErrNoRecord) {
+				return fmt.Errorf("guest %d: %w", part.GuestID, ErrUnknownGuest)
+			} else if err != nil {
+				return err
+			}
+
+			if stored[part.GuestID] == part.Attend {
+				continue
+			}
+
+			if part.Attend.Valid {
+				err = upsertParticipation(ctx, tx, part)
+			} else {
+				err = deleteParticipation(ctx, tx, eventID, part.GuestID)
+			}
+			if err != nil {
+				return err
+			}
+			n++
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer tx.Rollback()
 
-	event, err := updateEvent(ctx, tx, id, upd)
+	return n, nil
+}
+
+// countEvents counts events grouped by status in a single query.
+// Totals are computed by summing up the groups, including
+// the one of events without a status. Upcoming events end after now.
+func countEvents(ctx context.Context, tx *sql.Tx, defaultDuration, gracePeriod time.Duration, now time.Time) (*EventCounts, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT
+			statuses.id,
+			statuses.label,
+			statuses.color,
+			COUNT(*),
+			SUM(datetime(`+effectiveEndsAtSQL+`, ?) > datetime(?))
+		FROM events
+		LEFT JOIN statuses ON statuses.id = events.status
+		GROUP BY statuses.id
+		ORDER BY statuses.label`,
+		sqlModifier(defaultDuration),
+		sqlModifier(gracePeriod),
+		now.Format(layoutSQLite),
+	)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return event, tx.Commit()
-}
+	counts := EventCounts{ByStatus: make([]*StatusCount, 0)}
 
-func (s *EventService) Participate(ctx context.Context, part *Participation) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+	for rows.Next() {
+		var count StatusCount
+		var upcoming int
+		var id sql.NullInt64
+		var label, color sql.NullString
+
+		err = rows.Scan(&id, &label, &color, &count.N, &upcoming)
+		if err != nil {
+			return nil, err
+		}
+
+		counts.Total += count.N
+		counts.Upcoming += upcoming
+
+		if id.Valid {
+			count.Status = &Status{ID: int(id.Int64), Label: label.String, Color: color.String}
+			counts.ByStatus = append(counts.ByStatus, &count)
+		}
 	}
-	defer tx.Rollback()
 
-	err = participate(ctx, tx, part)
-	if err != nil {
-		return err
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	return &counts, nil
+}
+
+// countPendingEvents counts the events accepting responses, as told by
+// Event.AcceptsResponses at the given time, that the given guest hasn’t answered.
+func countPendingEvents(ctx context.Context, tx *sql.Tx, guestID int, defaultDuration, gracePeriod time.Duration, now time.Time) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*)
+		FROM events
+		WHERE datetime(`+effectiveEndsAtSQL+`, ?) > datetime(?)
+		AND (responses_open_at IS NULL OR datetime(responses_open_at) <= datetime(?))
+		AND cancelled_at IS NULL
+		AND id NOT IN (SELECT event_id FROM participations WHERE guest_id = ? AND attend IS NOT NULL)`,
+		sqlModifier(defaultDuration),
+		sqlModifier(gracePeriod),
+		now.Format(layoutSQLite),
+		now.Format(layoutSQLite),
+		guestID,
+	).Scan(&n)
+
+	return n, err
 }
 
 func findEvents(ctx context.Context, tx *sql.Tx, filter EventFilter) (_ []*Event, n int, err error) {
@@ -220,28 +769,85 @@ func findEvents(ctx context.Context, tx *sql.Tx, filter EventFilter) (_ []*Event
 		where, args = append(where, "title LIKE ?"), append(args, "%"+*filter.Title+"%")
 	}
 
-	order := "ASC"
+	if filter.Cancelled != nil {
+		if *filter.Cancelled {
+			where = append(where, "cancelled_at IS NOT NULL")
+		} else {
+			where = append(where, "cancelled_at IS NULL")
+		}
+	}
+
+	if filter.From != nil {
+		where = append(where, effectiveEndsAtSQL+" > datetime(?)")
+		args = append(args, sqlModifier(filter.defaultDuration), filter.From.UTC().Format(layoutSQLite))
+	}
+
+	if filter.To != nil {
+		where, args = append(where, "datetime(starts_at) < datetime(?)"), append(args, filter.To.UTC().Format(layoutSQLite))
+	}
+
+	desc := false
 	if filter.Past != nil {
+		// an event is past once its end, extended by the grace period,
+		// is reached in the time zone in which it has been entered
+		end := "datetime(" + effectiveEndsAtSQL + ", ?)"
+		args = append(args, sqlModifier(filter.defaultDuration), sqlModifier(filter.gracePeriod), wallClock(filter.now, filter.location).Format(layoutSQLite))
+
 		if *filter.Past {
-			where = append(where, "starts_at < date('now')")
-			order = "DESC"
+			where = append(where, end+" <= datetime(?)")
+			desc = true
 		} else {
-			where = append(where, "starts_at >= date('now')")
+			where = append(where, end+" > datetime(?)")
 		}
 	}
 
+	if filter.Reverse {
+		desc = !desc
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	order := "starts_at " + direction
+	if expr, ok := EventOrders[filter.Order]; ok && filter.Order != "date" {
+		order = fmt.Sprintf("%s %s, %s", expr, direction, order)
+
+		if filter.Order == "attendance" {
+			args = append(args, filter.ifNeeded == IfNeededAsYes)
+		}
+	}
+
+	limit := ""
+	if filter.Limit > 0 {
+		limit, args = "LIMIT ? OFFSET ?", append(args, filter.Limit, filter.Offset)
+	}
+
 	rows, err := tx.QueryContext(ctx,
 		`SELECT
 			id,
 			title,
 			starts_at,
 			ends_at,
+			all_day,
 			description,
 			status,
+			created_at,
+			updated_at,
+			responses_open_at,
+			cancelled_at,
+			default_no,
+			min_attendees,
+			max_attendees,
+			created_by,
+			(SELECT name FROM guests WHERE id = events.created_by),
+			(SELECT name FROM event_covers WHERE event_id = events.id),
 			COUNT(*) OVER()
 		FROM events
 		WHERE `+strings.Join(where, " AND ")+`
-		ORDER BY starts_at `+order,
+		ORDER BY `+order+`
+		`+limit,
 		args...,
 	)
 	if err != nil {
@@ -254,7 +860,7 @@ func findEvents(ctx context.Context, tx *sql.Tx, filter EventFilter) (_ []*Event
 	for rows.Next() {
 		var evt Event
 
-		err = rows.Scan(&evt.ID, &evt.Title, &evt.StartsAt, &evt.EndsAt, &evt.Description, &evt.StatusID, &n)
+		err = rows.Scan(&evt.ID, &evt.Title, &evt.StartsAt, &evt.EndsAt, &evt.AllDay, &evt.Description, &evt.StatusID, &evt.CreatedAt, &evt.UpdatedAt, &evt.ResponsesOpenAt, &evt.CancelledAt, &evt.DefaultNo, &evt.MinAttendees, &evt.MaxAttendees, &evt.CreatedByID, &evt.CreatedByName, &evt.CoverName, &n)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, 0, ErrNoRecord
@@ -273,10 +879,32 @@ func findEvents(ctx context.Context, tx *sql.Tx, filter EventFilter) (_ []*Event
 }
 
 func findEventByID(ctx context.Context, tx *sql.Tx, id int) (*Event, error) {
-	row := tx.QueryRowContext(ctx, `SELECT id, title, starts_at, ends_at, description, status FROM events WHERE id = ?`, id)
+	row := tx.QueryRowContext(ctx,
+		`SELECT
+			id,
+			title,
+			starts_at,
+			ends_at,
+			all_day,
+			description,
+			status,
+			created_at,
+			updated_at,
+			responses_open_at,
+			cancelled_at,
+			default_no,
+			min_attendees,
+			max_attendees,
+			created_by,
+			(SELECT name FROM guests WHERE id = events.created_by),
+			(SELECT name FROM event_covers WHERE event_id = events.id)
+		FROM events
+		WHERE id = ?`,
+		id,
+	)
 
 	var evt Event
-	err := row.Scan(&evt.ID, &evt.Title, &evt.StartsAt, &evt.EndsAt, &evt.Description, &evt.StatusID)
+	err := row.Scan(&evt.ID, &evt.Title, &evt.StartsAt, &evt.EndsAt, &evt.AllDay, &evt.Description, &evt.StatusID, &evt.CreatedAt, &evt.UpdatedAt, &evt.ResponsesOpenAt, &evt.CancelledAt, &evt.DefaultNo, &evt.MinAttendees, &evt.MaxAttendees, &evt.CreatedByID, &evt.CreatedByName, &evt.CoverName)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -288,13 +916,25 @@ func findEventByID(ctx context.Context, tx *sql.Tx, id int) (*Event, error) {
 }
 
 func createEvent(ctx context.Context, tx *sql.Tx, event *Event) error {
+	now := time.Now().UTC()
+	event.CreatedAt = sql.NullTime{Time: now, Valid: true}
+	event.UpdatedAt = sql.NullTime{Time: now, Valid: true}
+
 	res, err := tx.ExecContext(ctx,
-		`INSERT INTO events (title, starts_at, ends_at, description, status) VALUES (?, ?, ?, ?, ?)`,
+		`INSERT INTO events (title, starts_at, ends_at, all_day, description, status, created_at, updated_at, responses_open_at, default_no, min_attendees, max_attendees, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		event.Title,
 		event.StartsAt,
 		event.EndsAt,
+		event.AllDay,
 		event.Description,
 		event.StatusID,
+		event.CreatedAt,
+		event.UpdatedAt,
+		event.ResponsesOpenAt,
+		event.DefaultNo,
+		event.MinAttendees,
+		event.MaxAttendees,
+		event.CreatedByID,
 	)
 	if err != nil {
 		return err
@@ -309,12 +949,22 @@ func createEvent(ctx context.Context, tx *sql.Tx, event *Event) error {
 	return nil
 }
 
-func updateEvent(ctx context.Context, tx *sql.Tx, id int, upd EventUpdate) (*Event, error) {
+func updateEvent(ctx context.Context, tx *sql.Tx, id int, upd EventUpdate, actor string) (*Event, error) {
 	event, err := findEventByID(ctx, tx, id)
 	if err != nil {
 		return nil, err
 	}
 
+	fields, err := findFieldsByEvent(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := eventValues(ctx, tx, event, fields)
+	if err != nil {
+		return nil, err
+	}
+
 	if upd.Title != nil {
 		event.Title = *upd.Title
 	}
@@ -327,6 +977,10 @@ func updateEvent(ctx context.Context, tx *sql.Tx, id int, upd EventUpdate) (*Eve
 		event.EndsAt = *upd.EndsAt
 	}
 
+	if upd.AllDay != nil {
+		event.AllDay = *upd.AllDay
+	}
+
 	if upd.Description != nil {
 		event.Description = *upd.Description
 	}
@@ -335,19 +989,65 @@ func updateEvent(ctx context.Context, tx *sql.Tx, id int, upd EventUpdate) (*Eve
 		event.StatusID = *upd.StatusID
 	}
 
+	if upd.ResponsesOpenAt != nil {
+		event.ResponsesOpenAt = *upd.ResponsesOpenAt
+	}
+
+	if upd.CancelledAt != nil {
+		event.CancelledAt = *upd.CancelledAt
+	}
+
+	if upd.DefaultNo != nil {
+		event.DefaultNo = *upd.DefaultNo
+	}
+
+	if upd.MinAttendees != nil {
+		event.MinAttendees = *upd.MinAttendees
+	}
+
+	if upd.MaxAttendees != nil {
+		event.MaxAttendees = *upd.MaxAttendees
+	}
+
+	event.UpdatedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+
 	_, err = tx.ExecContext(ctx,
-		`UPDATE events SET title = ?, starts_at = ?, ends_at = ?, description = ?, status = ? WHERE id = ?`,
+		`UPDATE events SET title = ?, starts_at = ?, ends_at = ?, all_day = ?, description = ?, status = ?, updated_at = ?, responses_open_at = ?, cancelled_at = ?, default_no = ?, min_attendees = ?, max_attendees = ? WHERE id = ?`,
 		event.Title,
 		event.StartsAt,
 		event.EndsAt,
+		event.AllDay,
 		event.Description,
 		event.StatusID,
+		event.UpdatedAt,
+		event.ResponsesOpenAt,
+		event.CancelledAt,
+		event.DefaultNo,
+		event.MinAttendees,
+		event.MaxAttendees,
 		id,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if upd.Fields != nil {
+		if err := setFields(ctx, tx, id, *upd.Fields); err != nil {
+			return nil, err
+		}
+		fields = *upd.Fields
+	}
+	event.Fields = fields
+
+	after, err := eventValues(ctx, tx, event, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordChanges(ctx, tx, id, before, after, actor, event.UpdatedAt.Time); err != nil {
+		return nil, err
+	}
+
 	return event, nil
 }
 
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPastEventsInTimeZone(t *testing.T) {
+	tests := []struct {
+		zone string
+		now  time.Time
+
+		// dates of events as entered in the zone, the event
+		// lasting the default duration of two hours
+		past     []time.Time
+		upcoming []time.Time
+	}{
+		{
+			// late in the evening, UTC is already the next day
+			zone:     "America/Los_Angeles",
+			now:      time.Date(2030, 6, 2, 5, 30, 0, 0, time.UTC),
+			past:     []time.Time{time.Date(2030, 6, 1, 18, 0, 0, 0, time.UTC)},
+			upcoming: []time.Time{time.Date(2030, 6, 1, 21, 0, 0, 0, time.UTC), time.Date(2030, 6, 1, 23, 0, 0, 0, time.UTC)},
+		},
+		{
+			// just after midnight, UTC is still the previous morning
+			zone:     "Pacific/Kiritimati",
+			now:      time.Date(2030, 6, 1, 10, 30, 0, 0, time.UTC),
+			past:     []time.Time{time.Date(2030, 6, 1, 20, 0, 0, 0, time.UTC)},
+			upcoming: []time.Time{time.Date(2030, 6, 1, 23, 0, 0, 0, time.UTC), time.Date(2030, 6, 2, 9, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			app := newTestApp(t, func(cfg *config) { cfg.location = loc })
+			app.clock = func() time.Time { return tt.now }
+			app.initServices()
+
+			guest := mustCreateGuest(t, app, "Alice")
+
+			want := make(map[int]bool)
+			for _, startsAt := range tt.past {
+				want[mustCreateEvent(t, app, "Past", startsAt).ID] = true
+			}
+			for _, startsAt := range tt.upcoming {
+				want[mustCreateEvent(t, app, "Upcoming", startsAt).ID] = false
+			}
+
+			ctx := context.Background()
+
+			for _, past := range []bool{true, false} {
+				past := past
+				events, _, err := app.eventService.FindEvents(ctx, EventFilter{Past: &past})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var n int
+				for _, event := range events {
+					if want[event.ID] != past {
+						t.Errorf("%s at %s: got past %t", event.Title, event.StartsAt.Format(layoutDatetime), past)
+					}
+					if event.Upcoming() == past {
+						t.Errorf("%s at %s: got Upcoming %t", event.Title, event.StartsAt.Format(layoutDatetime), event.Upcoming())
+					}
+					n++
+				}
+				if past && n != len(tt.past) || !past && n != len(tt.upcoming) {
+					t.Errorf("got %d events with past %t", n, past)
+				}
+			}
+
+			pending, err := app.eventService.CountPending(ctx, guest.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pending != len(tt.upcoming) {
+				t.Errorf("got %d pending events, want %d", pending, len(tt.upcoming))
+			}
+		})
+	}
+}
+
+func TestPendingAsNoDeadline(t *testing.T) {
+	startsAt := time.Date(2030, 6, 1, 18, 0, 0, 0, time.UTC)
+	end := startsAt.Add(2 * time.Hour)
+
+	tests := []struct {
+		defaultNo   bool
+		gracePeriod time.Duration
+		now         time.Time
+		assumed     bool
+	}{
+		{true, 0, end.Add(-time.Second), false},
+		{true, 0, end, true},
+		{true, time.Hour, end.Add(59 * time.Minute), false},
+		{true, time.Hour, end.Add(time.Hour), true},
+		{false, 0, end.Add(24 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		app := newTestApp(t, func(cfg *config) { cfg.gracePeriod = tt.gracePeriod })
+		app.clock = func() time.Time { return tt.now }
+		app.initServices()
+
+		mustCreateGuest(t, app, "Alice")
+		event := &Event{Title: "Dinner", StartsAt: startsAt, DefaultNo: tt.defaultNo}
+		if err := app.eventService.CreateEvent(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+
+		event, err := app.eventService.FindEventByID(context.Background(), event.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := fmt.Sprintf("default no %t, grace period %s, %s after the end", tt.defaultNo, tt.gracePeriod, tt.now.Sub(end))
+
+		if event.PendingAsNo() != tt.assumed {
+			t.Errorf("%s: got PendingAsNo %t, want %t", name, event.PendingAsNo(), tt.assumed)
+		}
+
+		if len(event.Participations) != 1 {
+			t.Fatalf("%s: got %d participations, want the pending guest", name, len(event.Participations))
+		}
+
+		part := event.Participations[0]
+		if part.Assumed != tt.assumed || part.Attend.Valid != tt.assumed {
+			t.Errorf("%s: got participation %+v", name, part)
+		}
+		if tt.assumed && part.Attend.Int64 != AttendNo {
+			t.Errorf("%s: got assumed answer %d, want no", name, part.Attend.Int64)
+		}
+
+		// the stored participations are never changed
+		if n := len(mustFindParticipations(t, app, event.ID)); n != 0 {
+			t.Errorf("%s: got %d stored participations, want none", name, n)
+		}
+	}
+}
+
+func TestParticipateAll(t *testing.T) {
+	app := newTestApp(t, nil)
+	alice := mustCreateGuest(t, app, "Alice")
+	bob := mustCreateGuest(t, app, "Bob")
+	carol := mustCreateGuest(t, app, "Carol")
+	event := mustCreateEvent(t, app, "Rehearsal", time.Now().Add(48*time.Hour))
+
+	ctx := context.Background()
+	answer := func(attend int64) sql.NullInt64 { return sql.NullInt64{Int64: attend, Valid: true} }
+
+	for _, part := range []*Participation{
+		{EventID: event.ID, GuestID: alice.ID, Attend: answer(AttendYes)},
+		{EventID: event.ID, GuestID: bob.ID, Attend: answer(AttendNo)},
+	} {
+		if _, err := app.eventService.Participate(ctx, part); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// stored answers by guest
+	stored := func() map[int]int64 {
+		t.Helper()
+
+		answers := make(map[int]int64)
+		for _, part := range mustFindParticipations(t, app, event.ID) {
+			if !part.Attend.Valid {
+				t.Errorf("guest %d: got a stored participation without answer", part.GuestID)
+			}
+			answers[part.GuestID] = part.Attend.Int64
+		}
+
+		return answers
+	}
+
+	_, err := app.eventService.ParticipateAll(ctx, event.ID, []*Participation{
+		{GuestID: alice.ID},
+		{GuestID: 9999, Attend: answer(AttendYes)},
+	})
+	if !errors.Is(err, ErrUnknownGuest) {
+		t.Fatalf("answering for an unknown guest: got %v, want %v", err, ErrUnknownGuest)
+	}
+	if got := stored(); len(got) != 2 || got[alice.ID] != AttendYes {
+		t.Errorf("got answers %v after a failed update, want them unchanged", got)
+	}
+
+	_, err = app.eventService.ParticipateAll(ctx, event.ID+1, []*Participation{{GuestID: alice.ID}})
+	if !errors.Is(err, ErrNoRecord) {
+		t.Fatalf("answering to a missing event: got %v, want %v", err, ErrNoRecord)
+	}
+
+	n, err := app.eventService.ParticipateAll(ctx, event.ID, []*Participation{
+		{GuestID: alice.ID},
+		{GuestID: bob.ID, Attend: answer(AttendNo)},
+		{GuestID: carol.ID, Attend: answer(AttendIfNeeded)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d changed participations, want 2", n)
+	}
+
+	want := map[int]int64{bob.ID: AttendNo, carol.ID: AttendIfNeeded}
+	if got := stored(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got answers %v, want %v", got, want)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+	form := url.Values{"guest": {strconv.Itoa(9999)}, "attend": {strconv.Itoa(int(AttendYes))}}
+	if code, _ := c.do(http.MethodPost, fmt.Sprintf("/%d/participations", event.ID), form, nil); code != http.StatusBadRequest {
+		t.Errorf("answering for an unknown guest from the page: got status %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func BenchmarkFindGuestByID(b *testing.B) {
+	app := newTestApp(b, nil)
+	guest := mustCreateGuest(b, app, "Alice")
+
+	ctx := context.Background()
+
+	// half of the events are past, and the guest answered one in two
+	start := time.Now().Add(-500 * 24 * time.Hour)
+	for i := 0; i < 1000; i++ {
+		event := mustCreateEvent(b, app, fmt.Sprintf("Event %d", i), start.Add(time.Duration(i)*24*time.Hour))
+
+		if i%2 == 0 {
+			part := &Participation{EventID: event.ID, GuestID: guest.ID, Attend: sql.NullInt64{Int64: AttendYes, Valid: true}}
+			err := withTx(ctx, app.DB, func(tx *sql.Tx) error {
+				return upsertParticipation(ctx, tx, part)
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	histories := []struct {
+		name    string
+		history GuestHistory
+	}{
+		{"none", GuestHistory{}},
+		{"recent", GuestHistory{Limit: 10}},
+		{"all", GuestHistory{Limit: -1}},
+		{"all with pending", GuestHistory{Limit: -1, Pending: true}},
+	}
+
+	for _, h := range histories {
+		b.Run(h.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := app.guestService.FindGuestByID(ctx, guest.ID, h.history); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
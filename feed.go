@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Published string       `xml:"published,omitempty"`
+	Updated   string       `xml:"updated"`
+	Link      atomLink     `xml:"link"`
+	Summary   string       `xml:"summary"`
+	Content   *atomContent `xml:"content,omitempty"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// newAtomFeed builds an atom feed from a list of events.
+// The baseURL is used to generate absolute links to event pages.
+func newAtomFeed(title, baseURL, selfURL string, events []*Event) *atomFeed {
+	feed := atomFeed{
+		NS:    atomNS,
+		ID:    baseURL + "/",
+		Title: title,
+		Link: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: selfURL},
+			{Rel: "alternate", Type: "text/html", Href: baseURL + "/"},
+		},
+	}
+
+	var updated time.Time
+
+	for _, evt := range events {
+		link := fmt.Sprintf("%s/%d", baseURL, evt.ID)
+
+		entry := atomEntry{
+			ID:      link,
+			Title:   evt.Title,
+			Updated: evt.LastModified().UTC().Format(time.RFC3339),
+			Link:    atomLink{Rel: "alternate", Type: "text/html", Href: link},
+			Summary: evt.StartsAt.Format(layoutDatetime),
+		}
+
+		if evt.CreatedAt.Valid {
+			entry.Published = evt.CreatedAt.Time.UTC().Format(time.RFC3339)
+		}
+
+		if evt.Description.Valid {
+			entry.Content = &atomContent{Type: "html", Body: evt.Description.String}
+		}
+
+		if evt.LastModified().After(updated) {
+			updated = evt.LastModified()
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	return &feed
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	maxFieldKeyLength   = 50
+	maxFieldValueLength = 200
+)
+
+// findFieldsByEvent fetches the custom fields of an event as a map of values by key.
+func findFieldsByEvent(ctx context.Context, tx *sql.Tx, id int) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT key, value FROM event_fields WHERE event_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := make(map[string]string)
+
+	for rows.Next() {
+		var key, value string
+
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+
+		fields[key] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// setFields replaces the custom fields of an event.
+func setFields(ctx context.Context, tx *sql.Tx, id int, fields map[string]string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM event_fields WHERE event_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range fields {
+		_, err := tx.ExecContext(ctx, `INSERT INTO event_fields (event_id, key, value) VALUES (?, ?, ?)`, id, key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -11,4 +11,5 @@ require (
 	github.com/justinas/nosurf v1.1.1
 	github.com/lobre/bow v0.0.0-20221013120857-df7cb9378023 // indirect
 	github.com/mattn/go-sqlite3 v1.14.15
+	golang.org/x/crypto v0.0.0-20200317142112-1b76d66859c6
 )
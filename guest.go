@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -16,119 +18,160 @@ type Guest struct {
 	Name  string
 	Email string
 
-	// This is only set when returning a single guest.
+	// FeedToken authenticates the guest on feeds
+	// consumed outside of the browser session.
+	FeedToken string
+
+	// LinkToken is the secret of the personal link
+	// recognizing the guest in a browser.
+	LinkToken string
+
+	// Theme is the preferred color theme of the guest.
+	// It should be one of Themes.
+	Theme string
+
+	// This is only set when returning a single guest,
+	// as requested by the GuestHistory.
 	Participations []*Participation
 }
 
+// maxGuestResults is the maximum number of guests
+// returned when searching for a guest by name.
+const maxGuestResults = 10
+
+// profileHistoryLength is the number of recent responses
+// shown to a guest on their profile.
+const profileHistoryLength = 10
+
+// Themes lists the color themes a guest can choose from.
+// The auto theme follows the preference of the browser.
+var Themes = []string{"auto", "light", "dark"}
+
 type GuestFilter struct {
-	ID      *int
-	IDNotIn []int
+	ID        *int
+	IDNotIn   []int
+	FeedToken *string
+	LinkToken *string
+
+	// Name matches guests whose name contains the given text,
+	// ignoring case. Guests whose name starts with it come first.
+	Name *string
+
+	// EventAttend only keeps guests who gave the
+	// given response to the given event.
+	EventAttend *struct {
+		EventID int
+		Attend  int64
+	}
+
+	// Limit caps the number of returned guests when positive.
+	// The returned count still reflects all matching guests.
+	Limit int
 }
 
 // GuestUpdate represents a set of fields to be updated via UpdateGuest.
 type GuestUpdate struct {
 	Name  *string
 	Email *string
+	Theme *string
 }
 
 type GuestService struct {
 	db *bow.DB
 }
 
-func (s *GuestService) FindGuestByID(ctx context.Context, id int) (*Guest, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+// GuestHistory tells which participations to attach when finding a guest.
+// The zero value attaches none, which is enough to recognize a guest.
+type GuestHistory struct {
+	// Limit caps the number of attached answers, starting with the
+	// most recent events. A negative limit attaches all of them.
+	Limit int
 
-	guest, err := findGuestByID(ctx, tx, id)
-	if err != nil {
-		return nil, err
-	}
+	// Pending also attaches a participation with no answer
+	// for each event the guest hasn’t answered yet.
+	Pending bool
+}
 
-	// attach answered participations
-	guest.Participations, _, err = findParticipationsByGuest(ctx, tx, guest.ID)
-	if err != nil {
-		return nil, err
-	}
+// FindGuestByID retrieves a guest and attaches the participations requested by the history.
+func (s *GuestService) FindGuestByID(ctx context.Context, id int, history GuestHistory) (guest *Guest, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		guest, err = findGuestByID(ctx, tx, id)
+		if err != nil {
+			return err
+		}
 
-	var eventIDs []int
-	for _, part := range guest.Participations {
-		eventIDs = append(eventIDs, part.EventID)
-	}
+		if history.Limit != 0 {
+			guest.Participations, _, err = findParticipations(ctx, tx, ParticipationFilter{GuestID: &guest.ID, Limit: history.Limit})
+			if err != nil {
+				return err
+			}
+		}
 
-	// attach events to which the guest hasn’t answered yet
-	pending, _, err := findEvents(ctx, tx, EventFilter{IDNotIn: eventIDs})
-	if err != nil {
-		return nil, err
-	}
+		if history.Pending {
+			return attachUnansweredEvents(ctx, tx, guest)
+		}
 
-	// Add participations with attend that equals no answer for pending events
-	for _, event := range pending {
-		guest.Participations = append(guest.Participations, &Participation{
-			Guest:  guest,
-			Event:  event,
-			Attend: sql.NullInt64{},
-		})
-	}
+		return nil
+	})
 
-	return guest, nil
+	return guest, err
 }
 
-func (s *GuestService) FindGuests(ctx context.Context, filter GuestFilter) ([]*Guest, int, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer tx.Rollback()
+func (s *GuestService) FindGuests(ctx context.Context, filter GuestFilter) (guests []*Guest, n int, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		guests, n, err = findGuests(ctx, tx, filter)
+		return err
+	})
 
-	return findGuests(ctx, tx, filter)
+	return guests, n, err
 }
 
 func (s *GuestService) CreateGuest(ctx context.Context, guest *Guest) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	err = createGuest(ctx, tx, guest)
-	if err != nil {
-		return err
-	}
-
-	return tx.Commit()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return createGuest(ctx, tx, guest)
+	})
 }
 
 func (s *GuestService) DeleteGuest(ctx context.Context, id int) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil
-	}
-	defer tx.Rollback()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return deleteGuest(ctx, tx, id)
+	})
+}
 
-	err = deleteGuest(ctx, tx, id)
-	if err != nil {
+func (s *GuestService) UpdateGuest(ctx context.Context, id int, upd GuestUpdate) (guest *Guest, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		guest, err = updateGuest(ctx, tx, id, upd)
 		return err
-	}
+	})
 
-	return tx.Commit()
+	return guest, err
 }
 
-func (s *GuestService) UpdateGuest(ctx context.Context, id int, upd GuestUpdate) (*Guest, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
+// RotateTokens replaces the feed token and the personal link of a guest,
+// so that the previous feed and personal link stop working right away.
+// It returns the guest with the new tokens.
+func (s *GuestService) RotateTokens(ctx context.Context, id int) (guest *Guest, err error) {
+	feedToken, err := generateToken()
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
 
-	guest, err := updateGuest(ctx, tx, id, upd)
+	linkToken, err := generateToken()
 	if err != nil {
 		return nil, err
 	}
 
-	return guest, tx.Commit()
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE guests SET feed_token = ?, link_token = ? WHERE id = ?`, feedToken, linkToken, id)
+		if err != nil {
+			return err
+		}
+
+		guest, err = findGuestByID(ctx, tx, id)
+		return err
+	})
+
+	return guest, err
 }
 
 func findGuests(ctx context.Context, tx *sql.Tx, filter GuestFilter) (_ []*Guest, n int, err error) {
@@ -146,15 +189,43 @@ func findGuests(ctx context.Context, tx *sql.Tx, filter GuestFilter) (_ []*Guest
 		where = append(where, fmt.Sprintf("id NOT IN (%s)", strings.Join(placeholder, ",")))
 	}
 
+	if filter.FeedToken != nil {
+		where, args = append(where, "feed_token = ?"), append(args, *filter.FeedToken)
+	}
+
+	if filter.LinkToken != nil {
+		where, args = append(where, "link_token = ?"), append(args, *filter.LinkToken)
+	}
+
+	if filter.EventAttend != nil {
+		where = append(where, "id IN (SELECT guest_id FROM participations WHERE event_id = ? AND attend = ?)")
+		args = append(args, filter.EventAttend.EventID, filter.EventAttend.Attend)
+	}
+
+	orderBy := "name"
+	if filter.Name != nil {
+		where, args = append(where, "instr(lower(name), lower(?)) > 0"), append(args, *filter.Name)
+		orderBy, args = "instr(lower(name), lower(?)) <> 1, name", append(args, *filter.Name)
+	}
+
+	limit := ""
+	if filter.Limit > 0 {
+		limit, args = "LIMIT ?", append(args, filter.Limit)
+	}
+
 	rows, err := tx.QueryContext(ctx,
 		`SELECT
 			id,
 			name,
 			email,
+			feed_token,
+			link_token,
+			theme,
 			COUNT(*) OVER()
 		FROM guests
 		WHERE `+strings.Join(where, " AND ")+`
-		ORDER BY name`,
+		ORDER BY `+orderBy+`
+		`+limit,
 		args...,
 	)
 	if err != nil {
@@ -167,7 +238,7 @@ func findGuests(ctx context.Context, tx *sql.Tx, filter GuestFilter) (_ []*Guest
 	for rows.Next() {
 		var guest Guest
 
-		err = rows.Scan(&guest.ID, &guest.Name, &guest.Email, &n)
+		err = rows.Scan(&guest.ID, &guest.Name, &guest.Email, &guest.FeedToken, &guest.LinkToken, &guest.Theme, &n)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, 0, ErrNoRecord
@@ -186,10 +257,10 @@ func findGuests(ctx context.Context, tx *sql.Tx, filter GuestFilter) (_ []*Guest
 }
 
 func findGuestByID(ctx context.Context, tx *sql.Tx, id int) (*Guest, error) {
-	row := tx.QueryRowContext(ctx, `SELECT id, name, email FROM guests WHERE id = ?`, id)
+	row := tx.QueryRowContext(ctx, `SELECT id, name, email, feed_token, link_token, theme FROM guests WHERE id = ?`, id)
 
 	var guest Guest
-	err := row.Scan(&guest.ID, &guest.Name, &guest.Email)
+	err := row.Scan(&guest.ID, &guest.Name, &guest.Email, &guest.FeedToken, &guest.LinkToken, &guest.Theme)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -201,17 +272,27 @@ func findGuestByID(ctx context.Context, tx *sql.Tx, id int) (*Guest, error) {
 }
 
 func createGuest(ctx context.Context, tx *sql.Tx, guest *Guest) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	guest.FeedToken = token
+
+	guest.LinkToken, err = generateToken()
+	if err != nil {
+		return err
+	}
+
 	res, err := tx.ExecContext(ctx,
-		`INSERT INTO guests (name, email) VALUES (?, ?)`,
+		`INSERT INTO guests (name, email, feed_token, link_token) VALUES (?, ?, ?, ?)`,
 		guest.Name,
 		guest.Email,
+		guest.FeedToken,
+		guest.LinkToken,
 	)
 	if err != nil {
-		var sqliteError sqlite3.Error
-		if errors.As(err, &sqliteError) {
-			if sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique && strings.Contains(sqliteError.Error(), "guests.email") {
-				return ErrDuplicateEmail
-			}
+		if isDuplicateEmail(err) {
+			return ErrDuplicateEmail
 		}
 		return err
 	}
@@ -239,13 +320,21 @@ func updateGuest(ctx context.Context, tx *sql.Tx, id int, upd GuestUpdate) (*Gue
 		guest.Email = *upd.Email
 	}
 
+	if upd.Theme != nil {
+		guest.Theme = *upd.Theme
+	}
+
 	_, err = tx.ExecContext(ctx,
-		`UPDATE guests SET name = ?, email = ? WHERE id = ?`,
+		`UPDATE guests SET name = ?, email = ?, theme = ? WHERE id = ?`,
 		guest.Name,
 		guest.Email,
+		guest.Theme,
 		id,
 	)
 	if err != nil {
+		if isDuplicateEmail(err) {
+			return nil, ErrDuplicateEmail
+		}
 		return nil, err
 	}
 
@@ -260,3 +349,23 @@ func deleteGuest(ctx context.Context, tx *sql.Tx, id int) error {
 
 	return nil
 }
+
+// isDuplicateEmail reports whether err is the violation
+// of the unique constraint on the email of guests.
+func isDuplicateEmail(err error) bool {
+	var sqliteError sqlite3.Error
+	if errors.As(err, &sqliteError) {
+		return sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique && strings.Contains(sqliteError.Error(), "guests.email")
+	}
+	return false
+}
+
+// generateToken returns a random hex encoded token
+// that is long enough to be used as a secret in urls.
+func generateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUpdateGuestDuplicateEmail(t *testing.T) {
+	app := newTestApp(t, nil)
+	a := mustCreateGuest(t, app, "Alice")
+	b := mustCreateGuest(t, app, "Bob")
+
+	email := a.Email
+	if _, err := app.guestService.UpdateGuest(context.Background(), b.ID, GuestUpdate{Email: &email}); !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("got %v, want %v", err, ErrDuplicateEmail)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+
+	code, body := c.do(http.MethodPost, fmt.Sprintf("/guests/%d/edit", b.ID), url.Values{"name": {"Bob"}, "email": {a.Email}}, nil)
+	if code != http.StatusConflict {
+		t.Errorf("got status %d, want %d", code, http.StatusConflict)
+	}
+	if !strings.Contains(body, "The email address already exists") {
+		t.Errorf("the form doesn’t show the email as already existing")
+	}
+
+	guest, err := app.guestService.FindGuestByID(context.Background(), b.ID, GuestHistory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guest.Email != b.Email {
+		t.Errorf("got email %s, want it unchanged", guest.Email)
+	}
+}
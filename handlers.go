@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lobre/bow"
@@ -39,6 +47,9 @@ func (app *application) createStatus(w http.ResponseWriter, r *http.Request) {
 
 	form := bow.NewForm(r.PostForm)
 	form.Required("label", "color")
+	form.MatchesPattern("color", colorRX)
+	form.MaxLength("description", maxStatusDescriptionLength)
+	form.MaxLength("icon", maxStatusIconLength)
 
 	if !form.Valid() {
 		w.WriteHeader(http.StatusUnprocessableEntity)
@@ -48,9 +59,23 @@ func (app *application) createStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var description sql.NullString
+	if form.Get("description") != "" {
+		description.String = form.Get("description")
+		description.Valid = true
+	}
+
+	var icon sql.NullString
+	if form.Get("icon") != "" {
+		icon.String = form.Get("icon")
+		icon.Valid = true
+	}
+
 	s := Status{
-		Label: form.Get("label"),
-		Color: form.Get("color"),
+		Label:       form.Get("label"),
+		Color:       form.Get("color"),
+		Description: description,
+		Icon:        icon,
 	}
 
 	err = app.statusService.CreateStatus(r.Context(), &s)
@@ -62,6 +87,29 @@ func (app *application) createStatus(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/status", http.StatusSeeOther)
 }
 
+// seedStatuses adds the default statuses that don’t exist yet.
+// Labels are translated in the language of the admin, as in the setup.
+func (app *application) seedStatuses(w http.ResponseWriter, r *http.Request) {
+	locale := app.reqLocale(r)
+
+	var statuses []*Status
+	for _, status := range defaultStatuses {
+		statuses = append(statuses, &Status{
+			Label: app.translator.Translate(status.Label, locale),
+			Color: status.Color,
+		})
+	}
+
+	created, skipped, err := app.statusService.SeedStatuses(r.Context(), statuses)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Flash(r, fmt.Sprintf("%d statuses created, %d already existing", created, skipped))
+	http.Redirect(w, r, "/status", http.StatusSeeOther)
+}
+
 func (app *application) deleteStatus(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
@@ -73,6 +121,9 @@ func (app *application) deleteStatus(w http.ResponseWriter, r *http.Request) {
 	if err != nil && errors.Is(err, ErrStatusUsed) {
 		w.WriteHeader(http.StatusConflict)
 		app.Flash(r, "Can’t delete a status assigned to an existing event")
+	} else if err != nil && errors.Is(err, ErrLastStatus) {
+		w.WriteHeader(http.StatusConflict)
+		app.Flash(r, "Can’t delete the last status")
 	} else if err != nil {
 		app.Views.ServerError(w, err)
 		return
@@ -89,28 +140,173 @@ func (app *application) findEvents(w http.ResponseWriter, r *http.Request) {
 		filter.Title = &q
 	}
 
-	filter.Past = new(bool)
-	past := r.URL.Query().Get("past")
-	if past == "on" {
+	// the last chosen scope is remembered
+	scope := r.URL.Query().Get("scope")
+	if r.URL.Query().Get("past") == "on" {
+		// links from before scopes
+		scope = ScopePast
+	}
+	if !EventScopes[scope] {
+		scope = app.Session.GetString(r, "scope")
+	}
+	if !EventScopes[scope] {
+		scope = app.config.defaultScope
+	}
+	app.Session.Put(r, "scope", scope)
+
+	switch scope {
+	case ScopeUpcoming:
+		filter.Past = new(bool)
+	case ScopePast:
+		filter.Past = new(bool)
 		*filter.Past = true
+	case ScopeWeek:
+		from, to := currentWeek(app.now())
+		filter.From, filter.To = &from, &to
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if _, ok := EventOrders[sort]; !ok {
+		sort = "date"
+	}
+	filter.Order = sort
+
+	reverse := r.URL.Query().Get("reverse")
+	if reverse == "on" {
+		filter.Reverse = true
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
 	}
+	filter.Limit = app.config.perPage
+	filter.Offset = (page - 1) * app.config.perPage
 
-	events, _, err := app.eventService.FindEvents(r.Context(), filter)
+	events, n, err := app.eventService.FindEvents(r.Context(), filter)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	var nextPage int
+	if page*app.config.perPage < n {
+		nextPage = page + 1
+	}
+
+	form := bow.NewForm(url.Values{
+		"q":       []string{q},
+		"scope":   []string{scope},
+		"sort":    []string{sort},
+		"reverse": []string{reverse},
+	})
+
+	// only send the rows of the requested page to be added to the list
+	if bow.AcceptsStream(r) {
+		data := templateData{
+			Form:     form,
+			Events:   events,
+			NextPage: nextPage,
+		}
+
+		app.renderStream(bow.ActionAppend, "event_rows", w, r, "events/rows", data)
+		app.renderStream(bow.ActionReplace, "load_more", w, r, "events/more", data)
+		return
+	}
+
+	counts, err := app.eventService.CountEvents(r.Context())
 	if err != nil {
 		app.Views.ServerError(w, err)
 		return
 	}
 
 	app.Views.Render(w, r, "events/list", templateData{
-		Form: bow.NewForm(url.Values{
-			"q":    []string{q},
-			"past": []string{past},
-		}),
-		Events:     events,
-		AttendText: AttendText,
+		Form:     form,
+		Events:   events,
+		Counts:   counts,
+		NextPage: nextPage,
+	})
+}
+
+// agenda renders the events between two dates as a list meant to be printed.
+// Both dates are included and the range defaults to the current month.
+func (app *application) agenda(w http.ResponseWriter, r *http.Request) {
+	y, m, _ := app.now().Date()
+	from := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+
+	if date, err := time.Parse(layoutDate, r.URL.Query().Get("from")); err == nil {
+		from = date
+	}
+
+	if date, err := time.Parse(layoutDate, r.URL.Query().Get("to")); err == nil {
+		to = date
+	}
+
+	if to.Before(from) {
+		from, to = to, from
+	}
+
+	// events starting on the last day are included
+	end := to.AddDate(0, 0, 1)
+
+	events, _, err := app.eventService.FindEvents(r.Context(), EventFilter{From: &from, To: &end})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	form := bow.NewForm(url.Values{
+		"from": []string{from.Format(layoutDate)},
+		"to":   []string{to.Format(layoutDate)},
+	})
+
+	app.Views.Render(w, r, "events/agenda", templateData{
+		Form:   form,
+		Events: events,
 	})
 }
 
+func (app *application) feed(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, n, err := app.guestService.FindGuests(r.Context(), GuestFilter{FeedToken: &token})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	} else if n == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	events, _, err := app.eventService.FindEvents(r.Context(), EventFilter{Past: new(bool)})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	base := baseURL(r)
+	self := fmt.Sprintf("%s/feed.atom?token=%s", base, url.QueryEscape(token))
+
+	// encode to a buffer, so that an error doesn’t send a truncated feed
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(newAtomFeed(app.config.appName, base, self, events)); err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	buf.WriteTo(w)
+}
+
 func (app *application) findEventByID(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
@@ -134,7 +330,33 @@ func (app *application) findEventByID(w http.ResponseWriter, r *http.Request) {
 	app.Views.Render(w, r, "events/details", templateData{
 		Event:                event,
 		CurrentParticipation: currentPart,
-		AttendText:           AttendText,
+	})
+}
+
+// findRoster renders the guests of an event and their responses alone,
+// so that the frame showing them on the page of the event can be reloaded.
+func (app *application) findRoster(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.Views.ServerError(w, err)
+		}
+		return
+	}
+
+	// the current guest is shown apart, as on the page of the event
+	event.ExtractParticipation(currentGuest(r))
+
+	app.Views.Render(w, r, "events/roster", templateData{
+		Event: event,
 	})
 }
 
@@ -145,8 +367,17 @@ func (app *application) createEventForm(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// the nonce identifies this form to detect double submissions
+	nonce, err := generateToken()
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
 	app.Views.Render(w, r, "events/create_form", templateData{
-		Form:     bow.NewForm(nil),
+		Form: bow.NewForm(url.Values{
+			"nonce": []string{nonce},
+		}),
 		Statuses: statuses,
 	})
 }
@@ -159,25 +390,52 @@ func (app *application) createEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	form := bow.NewForm(r.PostForm)
-	form.Required("title", "status", "startdate", "starttime")
-	form.IsDate("startdate", "enddate")
+
+	// the same form has already been submitted, so
+	// redirect to the event it created instead of creating it twice
+	if nonce := form.Get("nonce"); nonce != "" && nonce == app.Session.GetString(r, "createdNonce") {
+		http.Redirect(w, r, fmt.Sprintf("/%d", app.Session.GetInt(r, "createdEvent")), http.StatusSeeOther)
+		return
+	}
+
+	form.Required("title", "startdate")
+	allDay := form.Get("allday") != ""
+	if !allDay {
+		form.Required("starttime")
+	}
+	if app.config.requireStatus {
+		form.Required("status")
+	}
+	form.MaxLength("title", app.config.maxTitleLength)
+	form.MaxLength("description", app.config.maxDescriptionLength)
+	app.normalizeDatetimes(r, form, []string{"startdate", "enddate", "opendate"}, []string{"starttime", "endtime"})
+	form.IsDate("startdate", "enddate", "opendate")
 	form.IsTime("starttime", "endtime")
 
-	if form.Get("enddate") != "" && form.Get("endtime") == "" {
-		form.CustomError("endtime", "This field cannot be blank as end date is filled")
+	app.checkStartDate(form, "startdate")
+
+	if form.Get("skipnotice") == "" {
+		app.checkNotice(form, "startdate", "starttime", allDay)
 	}
 
-	if form.Get("enddate") == "" && form.Get("endtime") != "" {
-		form.CustomError("enddate", "This field cannot be blank as end time is filled")
+	if !allDay {
+		requiredIf(form, "endtime", "enddate", "This field cannot be blank as end date is filled")
+		requiredIf(form, "enddate", "endtime", "This field cannot be blank as end time is filled")
+		isDuration(form, "duration")
+		exclusive(form, "duration", []string{"enddate", "endtime"}, "Fill either a duration or an end")
 	}
 
-	if !form.Valid() {
-		statuses, _, err := app.statusService.FindStatuses(r.Context())
-		if err != nil {
-			app.Views.ServerError(w, err)
-			return
-		}
+	checkAttendees(form, "minattendees", "maxattendees")
+
+	statuses, _, err := app.statusService.FindStatuses(r.Context())
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
 
+	checkStatus(form, "status", statuses)
+
+	if !form.Valid() {
 		w.WriteHeader(http.StatusUnprocessableEntity)
 		app.Views.Render(w, r, "events/create_form", templateData{
 			Form:     form,
@@ -186,21 +444,34 @@ func (app *application) createEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	statusID, err := strconv.Atoi(form.Get("status"))
-	if err != nil {
-		app.Views.ClientError(w, http.StatusBadRequest)
-		return
+	var statusID sql.NullInt64
+	if form.Get("status") != "" {
+		sid, err := strconv.Atoi(form.Get("status"))
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		statusID = sql.NullInt64{Int64: int64(sid), Valid: true}
+	}
+
+	startTime, endTime := form.Get("starttime"), form.Get("endtime")
+	if allDay {
+		// all day events are stored at midnight
+		startTime, endTime = "00:00", ""
+		if form.Get("enddate") != "" {
+			endTime = "00:00"
+		}
 	}
 
-	startDate, err := time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("startdate"), form.Get("starttime")))
+	startDate, err := time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("startdate"), startTime))
 	if err != nil {
 		app.Views.ClientError(w, http.StatusBadRequest)
 		return
 	}
 
 	var endDate sql.NullTime
-	if form.Get("enddate") != "" || form.Get("endtime") != "" {
-		endDate.Time, err = time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("enddate"), form.Get("endtime")))
+	if form.Get("enddate") != "" || endTime != "" {
+		endDate.Time, err = time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("enddate"), endTime))
 		if err != nil {
 			app.Views.ClientError(w, http.StatusBadRequest)
 			return
@@ -208,18 +479,59 @@ func (app *application) createEvent(w http.ResponseWriter, r *http.Request) {
 		endDate.Valid = true
 	}
 
+	// the end can be given as a duration instead
+	if duration := form.Get("duration"); duration != "" && !allDay {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		endDate = sql.NullTime{Time: startDate.Add(d), Valid: true}
+	}
+
 	var description sql.NullString
 	if form.Get("description") != "" {
 		description.String = form.Get("description")
 		description.Valid = true
 	}
 
+	var opensAt sql.NullTime
+	if form.Get("opendate") != "" {
+		opensAt.Time, err = time.Parse(layoutDate, form.Get("opendate"))
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		opensAt.Valid = true
+	}
+
+	minAttendees, err := parseNullInt(form.Get("minattendees"))
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	maxAttendees, err := parseNullInt(form.Get("maxattendees"))
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
 	evt := Event{
-		Title:       form.Get("title"),
-		StartsAt:    startDate,
-		EndsAt:      endDate,
-		Description: description,
-		StatusID:    statusID,
+		Title:           form.Get("title"),
+		StartsAt:        startDate,
+		EndsAt:          endDate,
+		AllDay:          allDay,
+		Description:     description,
+		StatusID:        statusID,
+		ResponsesOpenAt: opensAt,
+		DefaultNo:       form.Get("defaultno") != "",
+		MinAttendees:    minAttendees,
+		MaxAttendees:    maxAttendees,
+	}
+
+	if guest := currentGuest(r); guest != nil {
+		evt.CreatedByID = sql.NullInt64{Int64: int64(guest.ID), Valid: true}
 	}
 
 	err = app.eventService.CreateEvent(r.Context(), &evt)
@@ -228,9 +540,128 @@ func (app *application) createEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if nonce := form.Get("nonce"); nonce != "" {
+		app.Session.Put(r, "createdNonce", nonce)
+		app.Session.Put(r, "createdEvent", evt.ID)
+	}
+
+	if form.Get("force") == "" {
+		app.warnOverlapping(r, &evt)
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/%d", evt.ID), http.StatusSeeOther)
 }
 
+// checkStatus adds an error to the form when the given field
+// is filled with something else than the id of one of statuses.
+func checkStatus(form *bow.Form, field string, statuses []*Status) {
+	value := form.Get(field)
+	if value == "" {
+		return
+	}
+
+	for _, status := range statuses {
+		if strconv.Itoa(status.ID) == value {
+			return
+		}
+	}
+
+	form.CustomError(field, "This status doesn’t exist")
+}
+
+// checkAttendees adds an error to the form when the given minimum
+// and maximum numbers of attendees are not positive integers,
+// or when the minimum is above the maximum.
+func checkAttendees(form *bow.Form, minField, maxField string) {
+	form.IsInteger(minField, maxField)
+
+	for _, field := range []string{minField, maxField} {
+		if n, err := strconv.Atoi(form.Get(field)); err == nil && n <= 0 {
+			form.CustomError(field, "This field must be a positive number")
+		}
+	}
+
+	if form.Error(minField) != "" || form.Error(maxField) != "" {
+		return
+	}
+
+	min, err := strconv.Atoi(form.Get(minField))
+	if err != nil {
+		return
+	}
+
+	max, err := strconv.Atoi(form.Get(maxField))
+	if err != nil {
+		return
+	}
+
+	if min > max {
+		form.CustomError(minField, "The minimum cannot be above the maximum")
+	}
+}
+
+// parseNullInt parses an optional integer, which is null when empty.
+func parseNullInt(value string) (sql.NullInt64, error) {
+	if value == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	return sql.NullInt64{Int64: n, Valid: true}, nil
+}
+
+// checkStartDate adds an error to the form when the given date field is
+// too far in the past or in the future, which is most likely a typo.
+// It is only checked when creating events, so that admins can still
+// edit the past ones.
+func (app *application) checkStartDate(form *bow.Form, field string) {
+	if form.Error(field) != "" {
+		return
+	}
+
+	date, err := time.Parse(layoutDate, form.Get(field))
+	if err != nil {
+		return
+	}
+
+	y, m, d := app.now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	if app.config.maxDaysPast > 0 && date.Before(today.AddDate(0, 0, -app.config.maxDaysPast)) {
+		form.CustomError(field, "This date is too far in the past")
+	} else if app.config.maxYearsAhead > 0 && date.After(today.AddDate(app.config.maxYearsAhead, 0, 0)) {
+		form.CustomError(field, "This date is too far in the future")
+	}
+}
+
+// checkNotice adds an error to the form when the event would start sooner
+// than the minimum notice. All day events start at midnight. As with the
+// other bounds, it is only checked when creating events, and admins can
+// skip it when needed.
+func (app *application) checkNotice(form *bow.Form, dateField, timeField string, allDay bool) {
+	if app.config.minNotice <= 0 || form.Error(dateField) != "" || form.Error(timeField) != "" {
+		return
+	}
+
+	startTime := form.Get(timeField)
+	if allDay {
+		startTime = "00:00"
+	}
+
+	startsAt, err := time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get(dateField), startTime))
+	if err != nil {
+		return
+	}
+
+	if startsAt.Before(app.now().Add(app.config.minNotice)) {
+		form.CustomError(dateField, "This event starts too soon")
+	}
+}
+
 func (app *application) updateEventForm(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
@@ -256,14 +687,42 @@ func (app *application) updateEventForm(w http.ResponseWriter, r *http.Request)
 		endTime = evt.EndsAt.Time.Format(layoutTime)
 	}
 
+	var allDay string
+	if evt.AllDay {
+		allDay = "1"
+	}
+
+	var openDate string
+	if evt.ResponsesOpenAt.Valid {
+		openDate = evt.ResponsesOpenAt.Time.Format(layoutDate)
+	}
+
+	var defaultNo string
+	if evt.DefaultNo {
+		defaultNo = "1"
+	}
+
+	var minAttendees, maxAttendees string
+	if evt.MinAttendees.Valid {
+		minAttendees = strconv.FormatInt(evt.MinAttendees.Int64, 10)
+	}
+	if evt.MaxAttendees.Valid {
+		maxAttendees = strconv.FormatInt(evt.MaxAttendees.Int64, 10)
+	}
+
 	app.Views.Render(w, r, "events/update_form", templateData{
 		Form: bow.NewForm(url.Values{
-			"title":       []string{evt.Title},
-			"startdate":   []string{evt.StartsAt.Format(layoutDate)},
-			"starttime":   []string{evt.StartsAt.Format(layoutTime)},
-			"enddate":     []string{endDate},
-			"endtime":     []string{endTime},
-			"description": []string{evt.Description.String},
+			"title":        []string{evt.Title},
+			"startdate":    []string{evt.StartsAt.Format(layoutDate)},
+			"starttime":    []string{evt.StartsAt.Format(layoutTime)},
+			"enddate":      []string{endDate},
+			"endtime":      []string{endTime},
+			"allday":       []string{allDay},
+			"description":  []string{evt.Description.String},
+			"opendate":     []string{openDate},
+			"defaultno":    []string{defaultNo},
+			"minattendees": []string{minAttendees},
+			"maxattendees": []string{maxAttendees},
 		}),
 		Event:    evt,
 		Statuses: statuses,
@@ -284,16 +743,48 @@ func (app *application) updateEvent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	form := bow.NewForm(r.PostForm)
-	form.Required("title", "status", "startdate", "starttime")
-	form.IsDate("startdate", "enddate")
+	form.Required("title", "startdate")
+	allDay := form.Get("allday") != ""
+	if !allDay {
+		form.Required("starttime")
+	}
+	if app.config.requireStatus {
+		form.Required("status")
+	}
+	form.MaxLength("title", app.config.maxTitleLength)
+	form.MaxLength("description", app.config.maxDescriptionLength)
+	app.normalizeDatetimes(r, form, []string{"startdate", "enddate", "opendate"}, []string{"starttime", "endtime"})
+	form.IsDate("startdate", "enddate", "opendate")
 	form.IsTime("starttime", "endtime")
 
-	if form.Get("enddate") != "" && form.Get("endtime") == "" {
-		form.CustomError("endtime", "This field cannot be blank as end date is filled")
+	if !allDay {
+		requiredIf(form, "endtime", "enddate", "This field cannot be blank as end date is filled")
+		requiredIf(form, "enddate", "endtime", "This field cannot be blank as end time is filled")
+		isDuration(form, "duration")
+		exclusive(form, "duration", []string{"enddate", "endtime"}, "Fill either a duration or an end")
+	}
+
+	checkAttendees(form, "minattendees", "maxattendees")
+
+	// custom fields are sent as parallel lists of keys and values
+	keys, values := r.PostForm["field_key"], r.PostForm["field_value"]
+	if len(keys) != len(values) {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
 	}
 
-	if form.Get("enddate") == "" && form.Get("endtime") != "" {
-		form.CustomError("enddate", "This field cannot be blank as end time is filled")
+	fields := make(map[string]string)
+	for i, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		if len(key) > maxFieldKeyLength || len(values[i]) > maxFieldValueLength {
+			form.CustomError("fields", "A custom field is too long")
+		}
+
+		fields[key] = values[i]
 	}
 
 	if !form.Valid() {
@@ -319,21 +810,34 @@ func (app *application) updateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	statusID, err := strconv.Atoi(form.Get("status"))
-	if err != nil {
-		app.Views.ClientError(w, http.StatusBadRequest)
-		return
+	var statusID sql.NullInt64
+	if form.Get("status") != "" {
+		sid, err := strconv.Atoi(form.Get("status"))
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		statusID = sql.NullInt64{Int64: int64(sid), Valid: true}
+	}
+
+	startTime, endTime := form.Get("starttime"), form.Get("endtime")
+	if allDay {
+		// all day events are stored at midnight
+		startTime, endTime = "00:00", ""
+		if form.Get("enddate") != "" {
+			endTime = "00:00"
+		}
 	}
 
-	startDate, err := time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("startdate"), form.Get("starttime")))
+	startDate, err := time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("startdate"), startTime))
 	if err != nil {
 		app.Views.ClientError(w, http.StatusBadRequest)
 		return
 	}
 
 	var endDate sql.NullTime
-	if form.Get("enddate") != "" || form.Get("endtime") != "" {
-		endDate.Time, err = time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("enddate"), form.Get("endtime")))
+	if form.Get("enddate") != "" || endTime != "" {
+		endDate.Time, err = time.Parse(layoutDatetime, fmt.Sprintf("%s %s", form.Get("enddate"), endTime))
 		if err != nil {
 			app.Views.ClientError(w, http.StatusBadRequest)
 			return
@@ -341,6 +845,16 @@ func (app *application) updateEvent(w http.ResponseWriter, r *http.Request) {
 		endDate.Valid = true
 	}
 
+	// the end can be given as a duration instead
+	if duration := form.Get("duration"); duration != "" && !allDay {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		endDate = sql.NullTime{Time: startDate.Add(d), Valid: true}
+	}
+
 	title := form.Get("title")
 
 	var description sql.NullString
@@ -349,23 +863,79 @@ func (app *application) updateEvent(w http.ResponseWriter, r *http.Request) {
 		description.Valid = true
 	}
 
+	var opensAt sql.NullTime
+	if form.Get("opendate") != "" {
+		opensAt.Time, err = time.Parse(layoutDate, form.Get("opendate"))
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		opensAt.Valid = true
+	}
+
+	defaultNo := form.Get("defaultno") != ""
+
+	minAttendees, err := parseNullInt(form.Get("minattendees"))
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	maxAttendees, err := parseNullInt(form.Get("maxattendees"))
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
 	upd := EventUpdate{
 		Title:       &title,
 		StartsAt:    &startDate,
 		EndsAt:      &endDate,
+		AllDay:      &allDay,
 		Description: &description,
 		StatusID:    &statusID,
+		Fields:      &fields,
+
+		ResponsesOpenAt: &opensAt,
+		DefaultNo:       &defaultNo,
+		MinAttendees:    &minAttendees,
+		MaxAttendees:    &maxAttendees,
 	}
 
-	_, err = app.eventService.UpdateEvent(r.Context(), id, upd)
+	evt, err := app.eventService.UpdateEvent(r.Context(), id, upd, app.actorName(r))
 	if err != nil {
 		app.Views.ServerError(w, err)
 		return
 	}
 
+	if form.Get("force") == "" {
+		app.warnOverlapping(r, evt)
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/%d", id), http.StatusSeeOther)
 }
 
+// warnOverlapping flashes a notice listing the events taking place
+// at the same time as the given one. It doesn’t prevent saving.
+func (app *application) warnOverlapping(r *http.Request, evt *Event) {
+	events, err := app.eventService.FindOverlapping(r.Context(), evt)
+	if err != nil {
+		app.errorLog.Println(err)
+		return
+	}
+
+	if len(events) == 0 {
+		return
+	}
+
+	var titles []string
+	for _, e := range events {
+		titles = append(titles, e.Title)
+	}
+
+	app.Flash(r, fmt.Sprintf("This event overlaps with %s", strings.Join(titles, ", ")))
+}
+
 func (app *application) deleteEvent(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
@@ -382,73 +952,55 @@ func (app *application) deleteEvent(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func (app *application) findGuests(w http.ResponseWriter, r *http.Request) {
-	guests, _, err := app.guestService.FindGuests(r.Context(), GuestFilter{})
-	if err != nil {
-		app.Views.ServerError(w, err)
-		return
-	}
-
-	app.Views.Render(w, r, "guests/list", templateData{
-		Guests: guests,
-	})
+func (app *application) cancelEvent(w http.ResponseWriter, r *http.Request) {
+	app.setEventCancelled(w, r, true)
 }
 
-func (app *application) createGuestForm(w http.ResponseWriter, r *http.Request) {
-	app.Views.Render(w, r, "guests/create_form", templateData{
-		Form: bow.NewForm(nil),
-	})
+func (app *application) uncancelEvent(w http.ResponseWriter, r *http.Request) {
+	app.setEventCancelled(w, r, false)
 }
 
-func (app *application) createGuest(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+// setEventCancelled cancels an event or restores a cancelled one. Unlike
+// a deletion, the event and its responses are kept.
+func (app *application) setEventCancelled(w http.ResponseWriter, r *http.Request, cancelled bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
-		app.Views.ClientError(w, http.StatusBadRequest)
+		http.NotFound(w, r)
 		return
 	}
 
-	form := bow.NewForm(r.PostForm)
-	form.Required("name", "email")
-
-	if !form.Valid() {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		app.Views.Render(w, r, "guests/create_form", templateData{
-			Form: form,
-		})
-		return
+	var cancelledAt sql.NullTime
+	if cancelled {
+		cancelledAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
 	}
 
-	guest := Guest{
-		Name:  form.Get("name"),
-		Email: form.Get("email"),
+	_, err = app.eventService.UpdateEvent(r.Context(), id, EventUpdate{CancelledAt: &cancelledAt}, app.actorName(r))
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.Views.ServerError(w, err)
+		}
+		return
 	}
 
-	err = app.guestService.CreateGuest(r.Context(), &guest)
-	if err != nil && errors.Is(err, ErrDuplicateEmail) {
-		form.CustomError("email", "The email address already exists")
-
-		w.WriteHeader(http.StatusConflict)
-		app.Views.Render(w, r, "guests/create_form", templateData{
-			Form: form,
-		})
-
-		return
-	} else if err != nil {
-		app.Views.ServerError(w, err)
-		return
+	if cancelled {
+		app.Flash(r, "The event has been cancelled")
+	} else {
+		app.Flash(r, "The event has been restored")
 	}
 
-	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) updateGuestForm(w http.ResponseWriter, r *http.Request) {
+func (app *application) createAttachment(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	guest, err := app.guestService.FindGuestByID(r.Context(), id)
+	event, err := app.eventService.FindEventByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, ErrNoRecord) {
 			http.NotFound(w, r)
@@ -459,88 +1011,122 @@ func (app *application) updateGuestForm(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	app.Views.Render(w, r, "guests/update_form", templateData{
-		Form: bow.NewForm(url.Values{
-			"name":  []string{guest.Name},
-			"email": []string{guest.Email},
-		}),
-		Guest: guest,
-	})
-}
-
-func (app *application) updateGuest(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-
-	err = r.ParseForm()
+	err = r.ParseMultipartForm(1 << 20)
 	if err != nil {
 		app.Views.ClientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form := bow.NewForm(r.PostForm)
-	form.Required("name", "email")
+	form := bow.NewForm(r.MultipartForm.Value)
 
-	if !form.Valid() {
-		guest, err := app.guestService.FindGuestByID(r.Context(), id)
-		if err != nil {
-			app.Views.ServerError(w, err)
-			return
+	var data []byte
+	var contentType string
+
+	file, header, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		form.CustomError("file", "This field cannot be blank")
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	} else {
+		defer file.Close()
+
+		if header.Size > maxAttachmentSize {
+			form.CustomError("file", "This file is too large")
+		} else {
+			data, err = io.ReadAll(file)
+			if err != nil {
+				app.Views.ServerError(w, err)
+				return
+			}
+
+			// don’t trust the content type sent by the client
+			contentType, _, err = mime.ParseMediaType(http.DetectContentType(data))
+			if err != nil {
+				app.Views.ServerError(w, err)
+				return
+			}
+
+			if !allowedAttachmentType(contentType) {
+				form.CustomError("file", "This file type is not allowed")
+			}
 		}
+	}
 
+	if !form.Valid() {
 		w.WriteHeader(http.StatusUnprocessableEntity)
-		app.Views.Render(w, r, "guests/update_form", templateData{
-			Form:  form,
-			Guest: guest,
+		app.Views.Render(w, r, "events/details", templateData{
+			Form:                 form,
+			Event:                event,
+			CurrentParticipation: event.ExtractParticipation(currentGuest(r)),
 		})
-
 		return
 	}
 
-	name := form.Get("name")
-	email := form.Get("email")
-
-	upd := GuestUpdate{
-		Name:  &name,
-		Email: &email,
-	}
-
-	_, err = app.guestService.UpdateGuest(r.Context(), id, upd)
+	err = app.eventService.CreateAttachment(r.Context(), &Attachment{
+		EventID:     event.ID,
+		Filename:    filepath.Base(header.Filename),
+		ContentType: contentType,
+		Data:        data,
+	})
 	if err != nil {
 		app.Views.ServerError(w, err)
 		return
 	}
 
-	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/%d", event.ID), http.StatusSeeOther)
 }
 
-func (app *application) deleteGuest(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+func (app *application) findAttachment(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	err = app.guestService.DeleteGuest(r.Context(), id)
+	id, err := strconv.Atoi(r.URL.Query().Get(":attachment"))
 	if err != nil {
-		app.Views.ServerError(w, err)
+		http.NotFound(w, r)
 		return
 	}
 
-	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+	att, err := app.eventService.FindAttachmentByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	if att.EventID != eventID {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(att.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(att.Data)
 }
 
-func (app *application) participate(w http.ResponseWriter, r *http.Request) {
-	eventID, err := strconv.Atoi(r.URL.Query().Get(":event"))
+func (app *application) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	event, err := app.eventService.FindEventByID(r.Context(), eventID)
+	id, err := strconv.Atoi(r.URL.Query().Get(":attachment"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.eventService.DeleteAttachment(r.Context(), eventID, id)
 	if err != nil {
 		if errors.Is(err, ErrNoRecord) {
 			http.NotFound(w, r)
@@ -551,82 +1137,1530 @@ func (app *application) participate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	guestID, err := strconv.Atoi(r.URL.Query().Get(":guest"))
+	http.Redirect(w, r, fmt.Sprintf("/%d", eventID), http.StatusSeeOther)
+}
+
+func (app *application) setCover(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	if !app.isAdmin(r) && currentGuest(r).ID != guestID {
-		// can’t participate for another guest if not admin
-		app.Views.ClientError(w, http.StatusForbidden)
-		return
-	} else if !app.isAdmin(r) && !event.Upcoming() {
-		// can’t participate to past events if not admin
-		app.Views.ClientError(w, http.StatusForbidden)
-		return
+	event, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
 	}
 
-	err = r.ParseForm()
+	err = r.ParseMultipartForm(1 << 20)
 	if err != nil {
 		app.Views.ClientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form := bow.NewForm(r.PostForm)
+	form := bow.NewForm(r.MultipartForm.Value)
 
-	var attend sql.NullInt64
-	if form.Get("attend") != "" {
-		attend.Int64, err = strconv.ParseInt(form.Get("attend"), 10, 64)
-		if err != nil {
-			app.Views.ClientError(w, http.StatusBadRequest)
-			return
+	var cover *Cover
+
+	file, header, err := r.FormFile("cover")
+	if errors.Is(err, http.ErrMissingFile) {
+		form.CustomError("cover", "This field cannot be blank")
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	} else {
+		defer file.Close()
+
+		if header.Size > maxCoverSize {
+			form.CustomError("cover", "This file is too large")
+		} else {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				app.Views.ServerError(w, err)
+				return
+			}
+
+			// don’t trust the content type sent by the client
+			contentType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+			if err != nil {
+				app.Views.ServerError(w, err)
+				return
+			}
+
+			cover, err = newCover(event.ID, contentType, data)
+			if errors.Is(err, ErrInvalidImage) {
+				form.CustomError("cover", "This image is not valid or too large")
+			} else if err != nil {
+				app.Views.ServerError(w, err)
+				return
+			}
 		}
-		attend.Valid = true
 	}
 
-	err = app.eventService.Participate(r.Context(), &Participation{
-		EventID: eventID,
-		GuestID: guestID,
-		Attend:  attend,
-	})
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "events/details", templateData{
+			Form:                 form,
+			Event:                event,
+			CurrentParticipation: event.ExtractParticipation(currentGuest(r)),
+		})
+		return
+	}
+
+	err = app.eventService.SetCover(r.Context(), cover)
 	if err != nil {
 		app.Views.ServerError(w, err)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/%d", eventID), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/%d", event.ID), http.StatusSeeOther)
 }
 
-func (app *application) whoAreYou(w http.ResponseWriter, r *http.Request) {
-	guests, _, err := app.guestService.FindGuests(r.Context(), GuestFilter{})
+func (app *application) findCover(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
-		app.Views.ServerError(w, err)
+		http.NotFound(w, r)
 		return
 	}
 
-	app.Views.Render(w, r, "guests/whoareyou", templateData{
-		Guests: guests,
-	})
+	cover, err := app.eventService.FindCoverByEvent(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	// the name changes with the content, so an outdated url is not found
+	if cover.Name != r.URL.Query().Get(":name") {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", cover.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(cover.Data)))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(cover.Data)
 }
 
-func (app *application) iAm(w http.ResponseWriter, r *http.Request) {
+func (app *application) deleteCover(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	app.Session.Put(r, "guest", id)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
+	err = app.eventService.DeleteCover(r.Context(), id)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
 
-func (app *application) admin(w http.ResponseWriter, r *http.Request) {
-	app.Session.Put(r, "isAdmin", true)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/%d", id), http.StatusSeeOther)
 }
 
-func (app *application) noAdmin(w http.ResponseWriter, r *http.Request) {
+func (app *application) createComment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// foreign keys depend on the data source name and can’t be
+	// relied upon, so the event is looked up before commenting
+	event, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("body")
+	form.MaxLength("body", maxCommentLength)
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "events/details", templateData{
+			Form:                 form,
+			Event:                event,
+			CurrentParticipation: event.ExtractParticipation(currentGuest(r)),
+		})
+		return
+	}
+
+	comment := Comment{
+		EventID: id,
+		GuestID: currentGuest(r).ID,
+		Body:    form.Get("body"),
+	}
+
+	err = app.commentService.CreateComment(r.Context(), &comment)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	if bow.AcceptsStream(r) {
+		app.renderStream(bow.ActionAppend, "comments", w, r, "events/comment", &comment)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) deleteComment(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get(":comment"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	comment, err := app.commentService.FindCommentByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	// the comment must be reached through its own event
+	if comment.EventID != eventID {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !app.isAdmin(r) && currentGuest(r).ID != comment.GuestID {
+		// can’t delete the comment of another guest if not admin
+		app.Views.ClientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.commentService.DeleteComment(r.Context(), id)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	if bow.AcceptsStream(r) {
+		app.renderStream(bow.ActionRemove, fmt.Sprintf("comment_%d", id), w, r, "", nil)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%d", eventID), http.StatusSeeOther)
+}
+
+func (app *application) findGuests(w http.ResponseWriter, r *http.Request) {
+	var filter GuestFilter
+	var event *Event
+
+	// only keep guests with the given response to an event
+	if q := r.URL.Query(); q.Get("event") != "" && q.Get("attend") != "" {
+		eventID, err := strconv.Atoi(q.Get("event"))
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		attend, err := strconv.ParseInt(q.Get("attend"), 10, 64)
+		if _, ok := AttendText[attend]; err != nil || !ok {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		event, err = app.eventService.FindEventByID(r.Context(), eventID)
+		if err != nil {
+			if errors.Is(err, ErrNoRecord) {
+				http.NotFound(w, r)
+			} else {
+				app.Views.ServerError(w, err)
+			}
+			return
+		}
+
+		filter.EventAttend = &struct {
+			EventID int
+			Attend  int64
+		}{eventID, attend}
+	}
+
+	guests, _, err := app.guestService.FindGuests(r.Context(), filter)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	data := templateData{
+		Guests: guests,
+		Event:  event,
+	}
+
+	if filter.EventAttend != nil {
+		data.AttendFilter = AttendText[filter.EventAttend.Attend]
+	}
+
+	app.Views.Render(w, r, "guests/list", data)
+}
+
+func (app *application) createGuestForm(w http.ResponseWriter, r *http.Request) {
+	app.Views.Render(w, r, "guests/create_form", templateData{
+		Form: bow.NewForm(nil),
+	})
+}
+
+func (app *application) createGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("name", "email")
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "guests/create_form", templateData{
+			Form: form,
+		})
+		return
+	}
+
+	guest := Guest{
+		Name:  form.Get("name"),
+		Email: form.Get("email"),
+	}
+
+	err = app.guestService.CreateGuest(r.Context(), &guest)
+	if err != nil && errors.Is(err, ErrDuplicateEmail) {
+		form.CustomError("email", "The email address already exists")
+
+		w.WriteHeader(http.StatusConflict)
+		app.Views.Render(w, r, "guests/create_form", templateData{
+			Form: form,
+		})
+
+		return
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+}
+
+func (app *application) updateGuestForm(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	guest, err := app.guestService.FindGuestByID(r.Context(), id, GuestHistory{})
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	app.Views.Render(w, r, "guests/update_form", templateData{
+		Form: bow.NewForm(url.Values{
+			"name":  []string{guest.Name},
+			"email": []string{guest.Email},
+		}),
+		Guest: guest,
+	})
+}
+
+func (app *application) updateGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("name", "email")
+
+	if !form.Valid() {
+		guest, err := app.guestService.FindGuestByID(r.Context(), id, GuestHistory{})
+		if err != nil {
+			app.Views.ServerError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "guests/update_form", templateData{
+			Form:  form,
+			Guest: guest,
+		})
+
+		return
+	}
+
+	name := form.Get("name")
+	email := form.Get("email")
+
+	upd := GuestUpdate{
+		Name:  &name,
+		Email: &email,
+	}
+
+	_, err = app.guestService.UpdateGuest(r.Context(), id, upd)
+	if err != nil && errors.Is(err, ErrDuplicateEmail) {
+		guest, err := app.guestService.FindGuestByID(r.Context(), id, GuestHistory{})
+		if err != nil {
+			app.Views.ServerError(w, err)
+			return
+		}
+
+		form.CustomError("email", "The email address already exists")
+
+		w.WriteHeader(http.StatusConflict)
+		app.Views.Render(w, r, "guests/update_form", templateData{
+			Form:  form,
+			Guest: guest,
+		})
+
+		return
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+}
+
+func (app *application) profileForm(w http.ResponseWriter, r *http.Request) {
+	guest, err := app.guestService.FindGuestByID(r.Context(), currentGuest(r).ID, GuestHistory{Limit: profileHistoryLength})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Views.Render(w, r, "guests/profile", templateData{
+		Form: bow.NewForm(url.Values{
+			"name":  []string{guest.Name},
+			"email": []string{guest.Email},
+		}),
+		Guest: guest,
+	})
+}
+
+// updateProfile lets the recognized guest fix their own name and email.
+func (app *application) updateProfile(w http.ResponseWriter, r *http.Request) {
+	guest := currentGuest(r)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("name", "email")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "guests/profile", templateData{
+			Form:  form,
+			Guest: guest,
+		})
+		return
+	}
+
+	name := form.Get("name")
+	email := form.Get("email")
+
+	upd := GuestUpdate{
+		Name:  &name,
+		Email: &email,
+	}
+
+	_, err = app.guestService.UpdateGuest(r.Context(), guest.ID, upd)
+	if err != nil && errors.Is(err, ErrDuplicateEmail) {
+		form.CustomError("email", "The email address already exists")
+
+		w.WriteHeader(http.StatusConflict)
+		app.Views.Render(w, r, "guests/profile", templateData{
+			Form:  form,
+			Guest: guest,
+		})
+
+		return
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Flash(r, "Your profile has been updated")
+	http.Redirect(w, r, "/me/profile", http.StatusSeeOther)
+}
+
+func (app *application) deleteGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.guestService.DeleteGuest(r.Context(), id)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+}
+
+func (app *application) participate(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.URL.Query().Get(":event"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), eventID)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	guestID, err := strconv.Atoi(r.URL.Query().Get(":guest"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !app.isAdmin(r) && currentGuest(r).ID != guestID {
+		// can’t participate for another guest if not admin
+		app.Views.ClientError(w, http.StatusForbidden)
+		return
+	} else if !app.isAdmin(r) && !event.AcceptsResponses() {
+		// can’t participate to past or not yet open events if not admin
+		app.Views.ClientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+
+	var attend sql.NullInt64
+	if form.Get("attend") != "" {
+		attend.Int64, err = strconv.ParseInt(form.Get("attend"), 10, 64)
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		if _, ok := AttendText[attend.Int64]; !ok {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		attend.Valid = true
+	}
+
+	event, err = app.eventService.Participate(r.Context(), &Participation{
+		EventID: eventID,
+		GuestID: guestID,
+		Attend:  attend,
+	})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Flash(r, "Your response has been saved")
+
+	if bow.AcceptsStream(r) && currentGuest(r).ID == guestID {
+		app.renderStream(bow.ActionReplace, "my_participation", w, r, "events/participation", templateData{
+			Event:                event,
+			CurrentParticipation: event.ExtractParticipation(currentGuest(r)),
+		})
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%d", eventID), http.StatusSeeOther)
+}
+
+func (app *application) clearParticipation(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.URL.Query().Get(":event"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), eventID)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	guestID, err := strconv.Atoi(r.URL.Query().Get(":guest"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !app.isAdmin(r) && currentGuest(r).ID != guestID {
+		// can’t clear the response of another guest if not admin
+		app.Views.ClientError(w, http.StatusForbidden)
+		return
+	} else if !app.isAdmin(r) && !event.AcceptsResponses() {
+		// can’t change responses to past or not yet open events if not admin
+		app.Views.ClientError(w, http.StatusForbidden)
+		return
+	}
+
+	event, err = app.eventService.ClearParticipation(r.Context(), eventID, guestID)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Flash(r, "Your response has been cleared")
+
+	if bow.AcceptsStream(r) && currentGuest(r).ID == guestID {
+		app.renderStream(bow.ActionReplace, "my_participation", w, r, "events/participation", templateData{
+			Event:                event,
+			CurrentParticipation: event.ExtractParticipation(currentGuest(r)),
+		})
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/%d", eventID), http.StatusSeeOther)
+}
+
+func (app *application) participateAllForm(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	app.Views.Render(w, r, "events/participate_all_form", templateData{
+		Event: event,
+	})
+}
+
+func (app *application) participateAll(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// guests and answers are sent as two lists of the same length
+	guests, attends := r.PostForm["guest"], r.PostForm["attend"]
+	if len(guests) != len(attends) {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var parts []*Participation
+	for i := range guests {
+		guestID, err := strconv.Atoi(guests[i])
+		if err != nil {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		var attend sql.NullInt64
+		if attends[i] != "" {
+			attend.Int64, err = strconv.ParseInt(attends[i], 10, 64)
+			if err != nil {
+				app.Views.ClientError(w, http.StatusBadRequest)
+				return
+			}
+			if _, ok := AttendText[attend.Int64]; !ok {
+				app.Views.ClientError(w, http.StatusBadRequest)
+				return
+			}
+			attend.Valid = true
+		}
+
+		parts = append(parts, &Participation{GuestID: guestID, Attend: attend})
+	}
+
+	n, err := app.eventService.ParticipateAll(r.Context(), id, parts)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else if errors.Is(err, ErrUnknownGuest) {
+			app.Views.ClientError(w, http.StatusBadRequest)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	app.Flash(r, fmt.Sprintf("%d responses updated", n))
+	http.Redirect(w, r, fmt.Sprintf("/%d", id), http.StatusSeeOther)
+}
+
+// rsvpLinks lists the links letting each guest answer the event without being recognized.
+func (app *application) rsvpLinks(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	tokens, err := app.rsvpService.FindTokensByEvent(r.Context(), id)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Views.Render(w, r, "events/rsvp_links", templateData{
+		Event:      event,
+		RSVPTokens: tokens,
+	})
+}
+
+// rotateRSVP creates the link of a guest to the event,
+// or replaces it to revoke the previous one.
+func (app *application) rotateRSVP(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	guestID, err := strconv.Atoi(r.URL.Query().Get(":guest"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), eventID)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	guest, err := app.guestService.FindGuestByID(r.Context(), guestID, GuestHistory{})
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	_, err = app.rsvpService.RotateRSVP(r.Context(), event.ID, guest.ID)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Logger.Printf("answer link of guest %s to event %d rotated by %s", guest.Name, event.ID, app.actorName(r))
+
+	app.Flash(r, "The link has been regenerated")
+	http.Redirect(w, r, fmt.Sprintf("/%d/rsvp", event.ID), http.StatusSeeOther)
+}
+
+// findRSVP resolves the link of a guest to an event, returning
+// the link and the event. It writes the error response and
+// returns a nil link when it can’t be found.
+func (app *application) findRSVP(w http.ResponseWriter, r *http.Request) (*RSVP, *Event) {
+	rsvp, err := app.rsvpService.FindRSVPByToken(r.Context(), r.URL.Query().Get(":token"))
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.Views.ServerError(w, err)
+		}
+		return nil, nil
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), rsvp.EventID)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.Views.ServerError(w, err)
+		}
+		return nil, nil
+	}
+
+	return rsvp, event
+}
+
+// rsvpForm shows the response of the guest owning the link to its event,
+// without requiring them to be recognized.
+func (app *application) rsvpForm(w http.ResponseWriter, r *http.Request) {
+	rsvp, event := app.findRSVP(w, r)
+	if rsvp == nil {
+		return
+	}
+
+	app.Views.Render(w, r, "events/rsvp", templateData{
+		Form:                 bow.NewForm(url.Values{"token": []string{rsvp.Token}}),
+		Event:                event,
+		Guest:                rsvp.Guest,
+		CurrentParticipation: event.ExtractParticipation(rsvp.Guest),
+	})
+}
+
+// rsvp saves the response of the guest owning the link to its event.
+// It is only allowed while the event accepts responses.
+func (app *application) rsvp(w http.ResponseWriter, r *http.Request) {
+	rsvp, event := app.findRSVP(w, r)
+	if rsvp == nil {
+		return
+	}
+
+	if !event.AcceptsResponses() {
+		app.Views.ClientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	attend, err := strconv.ParseInt(r.PostForm.Get("attend"), 10, 64)
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	if _, ok := AttendText[attend]; !ok {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.eventService.Participate(r.Context(), &Participation{
+		EventID: rsvp.EventID,
+		GuestID: rsvp.GuestID,
+		Attend:  sql.NullInt64{Int64: attend, Valid: true},
+	})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Flash(r, "Your response has been saved")
+	http.Redirect(w, r, "/rsvp/"+rsvp.Token, http.StatusSeeOther)
+}
+
+// cleanParticipationsForm previews the participations of removed guests or events
+// that cleanParticipations would delete. The confirmation carries a token kept in
+// the session, so that the deletion can only be made once after a preview.
+func (app *application) cleanParticipationsForm(w http.ResponseWriter, r *http.Request) {
+	parts, err := app.eventService.CleanParticipations(r.Context(), true)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Session.Put(r, "cleanToken", token)
+
+	app.Views.Render(w, r, "guests/clean", templateData{
+		Form:           bow.NewForm(url.Values{"token": []string{token}}),
+		Participations: parts,
+	})
+}
+
+// cleanParticipations deletes the participations of removed guests or events.
+func (app *application) cleanParticipations(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	token := app.Session.PopString(r, "cleanToken")
+	if token == "" || r.PostForm.Get("token") != token {
+		app.Flash(r, "The preview has expired, please check it again")
+		http.Redirect(w, r, "/guests/clean", http.StatusSeeOther)
+		return
+	}
+
+	parts, err := app.eventService.CleanParticipations(r.Context(), false)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Flash(r, fmt.Sprintf("%d orphaned responses deleted", len(parts)))
+	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+}
+
+func (app *application) exportParticipations(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := app.eventService.FindEventByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("%s-%s.csv", slugify(event.Title), event.StartsAt.Format(layoutDate))
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	locale := app.reqLocale(r)
+
+	// rows are directly written to the response
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"name", "email", "attend"})
+
+	for _, part := range event.Participations {
+		attend := app.translateAttend(part.Attend, locale)
+
+		if err := cw.Write([]string{csvCell(part.Guest.Name), csvCell(part.Guest.Email), attend}); err != nil {
+			app.errorLog.Println(err)
+			return
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+func (app *application) whoAreYou(w http.ResponseWriter, r *http.Request) {
+	guests, _, err := app.guestService.FindGuests(r.Context(), GuestFilter{})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	if len(guests) == 0 {
+		needed, err := app.setupService.NeedsSetup(r.Context())
+		if err != nil {
+			app.Views.ServerError(w, err)
+			return
+		}
+
+		if needed {
+			http.Redirect(w, r, "/setup", http.StatusSeeOther)
+			return
+		}
+	}
+
+	app.Views.Render(w, r, "guests/whoareyou", templateData{
+		Form:   bow.NewForm(nil),
+		Guests: guests,
+	})
+}
+
+func (app *application) whoAreYouSearch(w http.ResponseWriter, r *http.Request) {
+	form := bow.NewForm(r.URL.Query())
+
+	filter := GuestFilter{Limit: maxGuestResults}
+	if q := strings.TrimSpace(form.Get("q")); q != "" {
+		filter.Name = &q
+	}
+
+	guests, _, err := app.guestService.FindGuests(r.Context(), filter)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	data := templateData{
+		Form:   form,
+		Guests: guests,
+	}
+
+	if bow.AcceptsStream(r) {
+		app.renderStream(bow.ActionReplace, "guest_picker", w, r, "guests/picker", data)
+		return
+	}
+
+	// without javascript, the search form submits to this page
+	app.Views.Render(w, r, "guests/whoareyou", data)
+}
+
+func (app *application) iAm(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	app.Session.Put(r, "guest", id)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// iAmLink recognizes the guest owning the personal link,
+// so that guests don’t have to pick their name.
+func (app *application) iAmLink(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get(":token")
+
+	guests, _, err := app.guestService.FindGuests(r.Context(), GuestFilter{LinkToken: &token})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	} else if len(guests) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	app.Session.Put(r, "guest", guests[0].ID)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// rotateTokens replaces the feed token and the personal link of a guest,
+// in case they have leaked.
+func (app *application) rotateTokens(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	guest, err := app.guestService.RotateTokens(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+			return
+		} else {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	app.Logger.Printf("tokens of guest %s rotated by %s", guest.Name, app.actorName(r))
+
+	app.Flash(r, "The links have been regenerated")
+	http.Redirect(w, r, fmt.Sprintf("/guests/%d/edit", id), http.StatusSeeOther)
+}
+
+// rotateMyTokens lets the recognized guest replace their own feed token and personal link.
+func (app *application) rotateMyTokens(w http.ResponseWriter, r *http.Request) {
+	guest, err := app.guestService.RotateTokens(r.Context(), currentGuest(r).ID)
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Logger.Printf("tokens of guest %s rotated by %s", guest.Name, app.actorName(r))
+
+	app.Flash(r, "The links have been regenerated")
+	http.Redirect(w, r, "/me/profile", http.StatusSeeOther)
+}
+
+func (app *application) setTheme(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("theme")
+	form.PermittedValues("theme", Themes...)
+
+	if !form.Valid() {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	theme := form.Get("theme")
+
+	guest, err := app.guestService.UpdateGuest(r.Context(), currentGuest(r).ID, GuestUpdate{Theme: &theme})
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	if bow.AcceptsStream(r) {
+		app.renderStream(bow.ActionReplace, "theme", w, r, "layouts/theme", guest.Theme)
+		return
+	}
+
+	redirect := r.Referer()
+	if redirect == "" {
+		redirect = "/"
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+func (app *application) setupForm(w http.ResponseWriter, r *http.Request) {
+	needed, err := app.setupService.NeedsSetup(r.Context())
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	if !needed {
+		http.NotFound(w, r)
+		return
+	}
+
+	app.Views.Render(w, r, "admin/setup", templateData{
+		Form:     bow.NewForm(nil),
+		Statuses: defaultStatuses,
+	})
+}
+
+func (app *application) setup(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("password", "confirmation", "name", "email")
+	form.MinLength("password", minPasswordLength)
+	form.IsEmail("email")
+
+	if form.Get("confirmation") != form.Get("password") {
+		form.CustomError("confirmation", "The passwords don’t match")
+	}
+
+	var statuses []*Status
+	for i, status := range defaultStatuses {
+		field := fmt.Sprintf("status_%d", i)
+		form.Required(field)
+
+		statuses = append(statuses, &Status{
+			Label: form.Get(field),
+			Color: status.Color,
+		})
+	}
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "admin/setup", templateData{
+			Form:     form,
+			Statuses: defaultStatuses,
+		})
+		return
+	}
+
+	guest := Guest{
+		Name:  form.Get("name"),
+		Email: form.Get("email"),
+	}
+
+	admin := Admin{
+		Username: bootstrapUsername,
+	}
+
+	err = app.setupService.Setup(r.Context(), &admin, form.Get("password"), statuses, &guest)
+	if err != nil {
+		if errors.Is(err, ErrSetupDone) {
+			http.NotFound(w, r)
+		} else {
+			app.Views.ServerError(w, err)
+		}
+		return
+	}
+
+	app.Session.Put(r, "guest", guest.ID)
+	app.Session.Put(r, "isAdmin", true)
+	app.Session.Put(r, "admin", admin.ID)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) admin(w http.ResponseWriter, r *http.Request) {
+	hasAdmins, err := app.adminService.HasAdmins(r.Context())
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	// without admin accounts, the admin mode is not protected
+	if !hasAdmins {
+		app.Session.Put(r, "isAdmin", true)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	app.Views.Render(w, r, "admin/login", templateData{
+		Form: bow.NewForm(nil),
+	})
+}
+
+func (app *application) login(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("username", "password")
+
+	var admin *Admin
+
+	if form.Valid() {
+		admin, err = app.adminService.Authenticate(r.Context(), form.Get("username"), form.Get("password"))
+		if errors.Is(err, ErrInvalidCredentials) {
+			form.CustomError("password", "Invalid username or password")
+		} else if err != nil {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "admin/login", templateData{
+			Form: form,
+		})
+		return
+	}
+
+	app.Logger.Printf("admin %s logged in", admin.Username)
+
+	app.Session.Put(r, "isAdmin", true)
+	app.Session.Put(r, "admin", admin.ID)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) noAdmin(w http.ResponseWriter, r *http.Request) {
 	app.Session.Remove(r, "isAdmin")
+
+	// the account is kept while impersonating
+	// to be able to restore the admin mode
+	if !app.Session.Exists(r, "impersonator") {
+		app.Session.Remove(r, "admin")
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) findAdmins(w http.ResponseWriter, r *http.Request) {
+	admins, err := app.adminService.FindAdmins(r.Context())
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Views.Render(w, r, "admin/list", templateData{
+		Admins: admins,
+	})
+}
+
+func (app *application) createAdminForm(w http.ResponseWriter, r *http.Request) {
+	app.Views.Render(w, r, "admin/create_form", templateData{
+		Form: bow.NewForm(nil),
+	})
+}
+
+func (app *application) createAdmin(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.PostForm)
+	form.Required("username", "password", "confirmation")
+	form.MaxLength("username", maxUsernameLength)
+	form.MinLength("password", minPasswordLength)
+
+	if form.Get("confirmation") != form.Get("password") {
+		form.CustomError("confirmation", "The passwords don’t match")
+	}
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "admin/create_form", templateData{
+			Form: form,
+		})
+		return
+	}
+
+	admin := Admin{
+		Username: strings.TrimSpace(form.Get("username")),
+	}
+
+	err = app.adminService.CreateAdmin(r.Context(), &admin, form.Get("password"))
+	if err != nil && errors.Is(err, ErrDuplicateUsername) {
+		form.CustomError("username", "The username already exists")
+
+		w.WriteHeader(http.StatusConflict)
+		app.Views.Render(w, r, "admin/create_form", templateData{
+			Form: form,
+		})
+
+		return
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	// once an account exists, the admin mode requires one, so
+	// the first account is given to the admin who created it
+	if currentAdmin(r) == nil {
+		app.Session.Put(r, "admin", admin.ID)
+	}
+
+	http.Redirect(w, r, "/admins", http.StatusSeeOther)
+}
+
+func (app *application) disableAdmin(w http.ResponseWriter, r *http.Request) {
+	app.setAdminDisabled(w, r, true)
+}
+
+func (app *application) enableAdmin(w http.ResponseWriter, r *http.Request) {
+	app.setAdminDisabled(w, r, false)
+}
+
+func (app *application) setAdminDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.adminService.SetAdminDisabled(r.Context(), id, disabled)
+	if err != nil && errors.Is(err, ErrLastAdmin) {
+		app.Flash(r, "Can’t disable the last admin")
+	} else if err != nil && errors.Is(err, ErrNoRecord) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admins", http.StatusSeeOther)
+}
+
+func (app *application) impersonate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, err = app.guestService.FindGuestByID(r.Context(), id, GuestHistory{})
+	if err != nil {
+		if errors.Is(err, ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.Views.ServerError(w, err)
+		}
+		return
+	}
+
+	// keep the original guest when switching from one impersonated guest to another
+	if !app.Session.Exists(r, "impersonator") {
+		app.Session.Put(r, "impersonator", app.Session.GetInt(r, "guest"))
+	}
+
+	app.Session.Put(r, "guest", id)
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+func (app *application) stopImpersonate(w http.ResponseWriter, r *http.Request) {
+	if !app.Session.Exists(r, "impersonator") {
+		http.NotFound(w, r)
+		return
+	}
+
+	// only admins can impersonate, so restore the admin mode
+	// in case it has been left while impersonating
+	app.Session.Put(r, "isAdmin", true)
+
+	if id := app.Session.PopInt(r, "impersonator"); id != 0 {
+		app.Session.Put(r, "guest", id)
+	} else {
+		app.Session.Remove(r, "guest")
+	}
+
+	http.Redirect(w, r, "/guests", http.StatusSeeOther)
+}
+
+func (app *application) stats(w http.ResponseWriter, r *http.Request) {
+	heatmap, err := app.statsService.AttendanceHeatmap(r.Context())
+	if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	}
+
+	app.Views.Render(w, r, "stats/heatmap", templateData{
+		Heatmap: heatmap,
+	})
+}
+
+func (app *application) backupForm(w http.ResponseWriter, r *http.Request) {
+	app.Views.Render(w, r, "admin/backup", templateData{
+		Form: bow.NewForm(nil),
+	})
+}
+
+// exportBackup sends the whole schedule as a json document that can be
+// restored with importBackup.
+func (app *application) exportBackup(w http.ResponseWriter, r *http.Request) {
+	filename := fmt.Sprintf("%s-%s.json", slugify(app.config.appName), time.Now().Format(layoutDate))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	// the backup is directly written to the response, so an error
+	// can only be logged, leaving a truncated file that can’t be imported
+	if err := app.backupService.Export(r.Context(), w); err != nil {
+		app.errorLog.Println(err)
+	}
+}
+
+// importBackup restores a backup made with exportBackup. It refuses to
+// overwrite existing data unless the force checkbox is checked.
+func (app *application) importBackup(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(1 << 20)
+	if err != nil {
+		app.Views.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := bow.NewForm(r.MultipartForm.Value)
+
+	var b backup
+
+	file, _, err := r.FormFile("backup")
+	if errors.Is(err, http.ErrMissingFile) {
+		form.CustomError("backup", "This field cannot be blank")
+	} else if err != nil {
+		app.Views.ServerError(w, err)
+		return
+	} else {
+		defer file.Close()
+
+		if err := json.NewDecoder(file).Decode(&b); err != nil {
+			form.CustomError("backup", "This file is not a valid backup")
+		}
+	}
+
+	if form.Valid() {
+		err = app.backupService.Import(r.Context(), &b, form.Get("force") == "on")
+		if errors.Is(err, ErrInvalidBackup) {
+			app.debugLog.Println(err)
+			form.CustomError("backup", "This file is not a valid backup")
+		} else if errors.Is(err, ErrNotEmpty) {
+			form.CustomError("force", "The database already contains data")
+		} else if err != nil {
+			app.Views.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		app.Views.Render(w, r, "admin/backup", templateData{
+			Form: form,
+		})
+		return
+	}
+
+	app.Flash(r, "The backup has been restored")
+	http.Redirect(w, r, "/backup", http.StatusSeeOther)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lobre/bow"
+)
+
+func TestCheckStartDate(t *testing.T) {
+	now := time.Date(2030, 6, 15, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		maxDaysPast   int
+		maxYearsAhead int
+		date          string
+		valid         bool
+	}{
+		{30, 2, "2030-05-16", true},
+		{30, 2, "2030-05-15", false},
+		{30, 2, "2032-06-15", true},
+		{30, 2, "2032-06-16", false},
+		{0, 0, "2000-01-01", true},
+		{0, 0, "2100-01-01", true},
+	}
+
+	for _, tt := range tests {
+		app := &application{
+			config: config{maxDaysPast: tt.maxDaysPast, maxYearsAhead: tt.maxYearsAhead},
+			clock:  func() time.Time { return now },
+		}
+
+		form := bow.NewForm(url.Values{"startdate": {tt.date}})
+		app.checkStartDate(form, "startdate")
+
+		if valid := form.Error("startdate") == ""; valid != tt.valid {
+			t.Errorf("%s within %d days past and %d years ahead: got valid %t, want %t", tt.date, tt.maxDaysPast, tt.maxYearsAhead, valid, tt.valid)
+		}
+	}
+}
+
+func TestCreateEventWithoutStatuses(t *testing.T) {
+	app := newTestApp(t, nil)
+	c := newTestClient(t, app).asAdmin()
+
+	code, body := c.do(http.MethodGet, "/new", nil, nil)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if !strings.Contains(body, `href="/status/new"`) {
+		t.Errorf("the page doesn’t link to the creation of a status")
+	}
+	if strings.Contains(body, `action="/new"`) {
+		t.Errorf("the page shows the form, which can’t be submitted")
+	}
+
+	form := url.Values{"title": {"Rehearsal"}, "startdate": {time.Now().AddDate(0, 0, 7).Format(layoutDate)}, "starttime": {"20:00"}, "status": {"1"}}
+	if code, _ := c.do(http.MethodPost, "/new", form, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("submitting with a missing status: got status %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if _, n, err := app.eventService.FindEvents(context.Background(), EventFilter{}); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("got %d events, want none", n)
+	}
+
+	// without required statuses, the form is shown as usual
+	app.config.requireStatus = false
+	if _, body := c.do(http.MethodGet, "/new", nil, nil); !strings.Contains(body, `action="/new"`) {
+		t.Errorf("the form isn’t shown when statuses are not required")
+	}
+}
+
+func TestCheckNotice(t *testing.T) {
+	now := time.Date(2030, 6, 15, 10, 0, 0, 0, time.UTC)
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		minNotice time.Duration
+		location  *time.Location
+		date      string
+		time      string
+		allDay    bool
+		valid     bool
+	}{
+		{24 * time.Hour, time.UTC, "2030-06-16", "10:00", false, true},
+		{24 * time.Hour, time.UTC, "2030-06-16", "09:59", false, false},
+		{24 * time.Hour, time.UTC, "2030-06-16", "", true, false},
+		{24 * time.Hour, time.UTC, "2030-06-17", "", true, true},
+
+		// dates are entered in the time zone of the application
+		{24 * time.Hour, paris, "2030-06-16", "12:00", false, true},
+		{24 * time.Hour, paris, "2030-06-16", "11:59", false, false},
+
+		{0, time.UTC, "2030-06-15", "09:00", false, true},
+	}
+
+	for _, tt := range tests {
+		app := &application{
+			config: config{minNotice: tt.minNotice, location: tt.location},
+			clock:  func() time.Time { return now },
+		}
+
+		form := bow.NewForm(url.Values{"startdate": {tt.date}, "starttime": {tt.time}})
+		app.checkNotice(form, "startdate", "starttime", tt.allDay)
+
+		if valid := form.Error("startdate") == ""; valid != tt.valid {
+			t.Errorf("%s %s in %s with a notice of %s: got valid %t, want %t", tt.date, tt.time, tt.location, tt.minNotice, valid, tt.valid)
+		}
+	}
+}
+
+func TestExportParticipations(t *testing.T) {
+	app := newTestApp(t, func(cfg *config) { cfg.locale = "fr_FR" })
+	event := mustCreateEvent(t, app, "Rehearsal", time.Now().Add(48*time.Hour))
+	bob := mustCreateGuest(t, app, "Bob")
+
+	formula := &Guest{Name: `=HYPERLINK("http://evil.example.com")`, Email: "@carol@example.com"}
+	if err := app.guestService.CreateGuest(context.Background(), formula); err != nil {
+		t.Fatal(err)
+	}
+
+	part := &Participation{EventID: event.ID, GuestID: bob.ID, Attend: sql.NullInt64{Int64: AttendYes, Valid: true}}
+	if _, err := app.eventService.Participate(context.Background(), part); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+
+	code, body := c.do(http.MethodGet, fmt.Sprintf("/%d/participation.csv", event.ID), nil, nil)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"name", "email", "attend"},
+		{"Bob", "bob@example.com", "oui"},
+		{`'=HYPERLINK("http://evil.example.com")`, "'@carol@example.com", "pas de réponse"},
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("got rows %q, want %q", rows, want)
+	}
+}
+
+func TestOverlapNoticeSkipsCancelled(t *testing.T) {
+	app := newTestApp(t, func(cfg *config) { cfg.requireStatus = false })
+	ctx := context.Background()
+
+	day := time.Now().AddDate(0, 0, 7)
+	at := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), 20, 0, 0, 0, time.UTC)
+	}
+
+	cancelled := mustCreateEvent(t, app, "Concert", at(day))
+	cancelledAt := sql.NullTime{Time: time.Now(), Valid: true}
+	if _, err := app.eventService.UpdateEvent(ctx, cancelled.ID, EventUpdate{CancelledAt: &cancelledAt}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	mustCreateEvent(t, app, "Party", at(day.AddDate(0, 0, 1)))
+
+	c := newTestClient(t, app).asAdmin()
+
+	tests := []struct {
+		title  string
+		day    time.Time
+		notice string
+	}{
+		{"Rehearsal", day, ""},
+		{"Dinner", day.AddDate(0, 0, 1), "This event overlaps with Party"},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"title": {tt.title}, "startdate": {tt.day.Format(layoutDate)}, "starttime": {"20:00"}}
+		if code, body := c.do(http.MethodPost, "/new", form, nil); code != http.StatusSeeOther {
+			t.Fatalf("creating %s: got status %d: %s", tt.title, code, body)
+		}
+
+		// the notice is flashed on the next page
+		_, body := c.do(http.MethodGet, "/status", nil, nil)
+		if tt.notice == "" && strings.Contains(body, "This event overlaps with") {
+			t.Errorf("creating %s: got an overlap notice, want none", tt.title)
+		}
+		if tt.notice != "" && !strings.Contains(body, tt.notice) {
+			t.Errorf("creating %s: the notice %q is not shown", tt.title, tt.notice)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// sourceLocale is the locale of the messages in the views,
+// that needs no translation file.
+const sourceLocale = "en_US"
+
+// parseLocales parses a comma separated list of locales
+// and checks that each of them has a translation file in fsys.
+func parseLocales(fsys fs.FS, s string) (map[string]bool, error) {
+	locales := map[string]bool{sourceLocale: true}
+
+	for _, locale := range strings.Split(s, ",") {
+		locale = strings.TrimSpace(locale)
+		if locale == "" || locale == sourceLocale {
+			continue
+		}
+
+		if _, err := fs.Stat(fsys, path.Join("translations", locale+".csv")); err != nil {
+			return nil, fmt.Errorf("unknown locale %q", locale)
+		}
+
+		locales[locale] = true
+	}
+
+	return locales, nil
+}
+
+// localesFS hides the translation files of the locales that are not enabled,
+// so that the translators do not recognize them in requests.
+type localesFS struct {
+	fs.FS
+	enabled map[string]bool
+}
+
+func (fsys localesFS) hidden(name string) bool {
+	dir, file := path.Split(name)
+	if dir != "translations/" || path.Ext(file) != ".csv" {
+		return false
+	}
+	return !fsys.enabled[strings.TrimSuffix(file, ".csv")]
+}
+
+func (fsys localesFS) Open(name string) (fs.File, error) {
+	if fsys.hidden(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return fsys.FS.Open(name)
+}
+
+func (fsys localesFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys.FS, name)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !fsys.hidden(path.Join(name, entry.Name())) {
+			visible = append(visible, entry)
+		}
+	}
+
+	return visible, nil
+}
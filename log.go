@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelError = "error"
+)
+
+// LogLevels ranks the levels of -log-level, from the most verbose.
+var LogLevels = map[string]int{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelError: 2,
+}
+
+// loggers are the loggers of each level. They share the same destination,
+// and the ones below the configured level discard their messages.
+// The info logger is given to the core, so that it also carries
+// the requests and the lifecycle of the server.
+type loggers struct {
+	debug *log.Logger
+	info  *log.Logger
+	error *log.Logger
+}
+
+// newLoggers creates the loggers of the given level, writing to w.
+func newLoggers(w io.Writer, level string) (*loggers, error) {
+	rank, ok := LogLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("invalid -log-level %q", level)
+	}
+
+	writer := func(l string) io.Writer {
+		if LogLevels[l] < rank {
+			return io.Discard
+		}
+		return w
+	}
+
+	flags := log.Ldate | log.Ltime
+
+	return &loggers{
+		debug: log.New(writer(LevelDebug), "DEBUG ", flags),
+		info:  log.New(writer(LevelInfo), "", flags),
+		error: log.New(writer(LevelError), "ERROR ", flags),
+	}, nil
+}
+
+// openLogFile opens the given file for appending logs,
+// or returns stdout when the path is empty.
+func openLogFile(path string) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+}
+
+// nopCloser keeps stdout open when the logs are closed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
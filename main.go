@@ -1,15 +1,26 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
+	"log"
+	"net"
 	"net/http"
 	"os"
+	"path"
+	"sync/atomic"
 	"time"
 
+	// the time zone database is embedded, as the docker image doesn’t provide it
+	_ "time/tzdata"
+
+	"github.com/benbjohnson/hashfs"
 	"github.com/lobre/bow"
 )
 
@@ -19,12 +30,24 @@ const (
 	layoutDatetime = "2006-01-02 15:04"
 	layoutDate     = "2006-01-02"
 	layoutTime     = "15:04"
+
+	// defaultSessionKey is only meant for development,
+	// as anyone can forge cookies with it.
+	defaultSessionKey = "xxx"
+
+	// sessionKeyLength is the length of the keys used to encrypt cookies.
+	sessionKeyLength = 32
+
+	// layoutSQLite is the format of the dates returned by the SQLite date functions.
+	layoutSQLite = "2006-01-02 15:04:05"
 )
 
 //go:embed views/layouts/*.html
 //go:embed views/events/*.html
 //go:embed views/guests/*.html
 //go:embed views/statuses/*.html
+//go:embed views/admin/*.html
+//go:embed views/stats/*.html
 //go:embed migrations/*.sql
 //go:embed translations/*.csv
 //go:embed assets
@@ -34,14 +57,98 @@ var (
 	ErrNoRecord       = errors.New("no record")
 	ErrDuplicateEmail = errors.New("duplicate email")
 	ErrStatusUsed     = errors.New("status used")
+	ErrLastStatus     = errors.New("last status")
+	ErrUnknownGuest   = errors.New("unknown guest")
+
+	ErrDuplicateUsername = errors.New("duplicate username")
+	ErrLastAdmin         = errors.New("last admin")
+
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrSetupDone          = errors.New("setup done")
+	ErrInvalidImage       = errors.New("invalid image")
+
+	ErrInvalidBackup = errors.New("invalid backup")
+	ErrNotEmpty      = errors.New("database not empty")
 )
 
 type config struct {
 	port       int
 	dsn        string
 	sessionKey string
+	production bool
 	locale     string
+	locales    string
+	appName    string
 	logo       string
+	favicon    string
+	touchIcon  string
+	startURL   string
+	themeColor string
+	seed       string
+	perPage    int
+
+	// logFile is where logs are written, stdout when empty.
+	logFile string
+
+	// logLevel is one of LogLevels.
+	logLevel string
+
+	// defaultScope is one of EventScopes, used when
+	// guests haven’t chosen one yet.
+	defaultScope string
+
+	// listColumns are the keys of EventColumns
+	// displayed in the list of events.
+	listColumns map[string]bool
+
+	// trustedProxies are the reverse proxies allowed
+	// to tell the IP address of clients.
+	trustedProxies []*net.IPNet
+
+	// cookiePrefix is prepended to the names of all the cookies,
+	// so that several instances can share a domain.
+	cookiePrefix string
+
+	// basicAuthUser and basicAuthHash are the credentials
+	// asked for every request, when set.
+	basicAuthUser string
+	basicAuthHash []byte
+
+	// requireStatus makes the status mandatory on events,
+	// and keeps the last one from being removed.
+	requireStatus bool
+
+	// maxTitleLength and maxDescriptionLength are the maximum
+	// number of characters of the title and the description of events.
+	maxTitleLength       int
+	maxDescriptionLength int
+
+	defaultDuration time.Duration
+	gracePeriod     time.Duration
+
+	// location is the time zone in which the dates of events are
+	// entered, which tells when they are past.
+	location *time.Location
+
+	// refreshInterval is how often the guests of an
+	// event are reloaded on its page, when positive.
+	refreshInterval time.Duration
+
+	// minNotice is how long in advance new
+	// events must be created, when positive.
+	minNotice time.Duration
+
+	// maxDaysPast and maxYearsAhead bound the start
+	// of new events, when positive.
+	maxDaysPast   int
+	maxYearsAhead int
+
+	// ifNeeded is one of IfNeededModes.
+	ifNeeded string
+
+	// pendingLabel is displayed for guests who haven’t
+	// answered, and can be translated like other messages.
+	pendingLabel string
 }
 
 type application struct {
@@ -49,9 +156,36 @@ type application struct {
 
 	config config
 
-	statusService *StatusService
-	guestService  *GuestService
-	eventService  *EventService
+	// translator is only used to find the locale of requests,
+	// as the translations themselves are done by the views.
+	translator *bow.Translator
+
+	// basicAuthDigest holds the digest of the last credentials
+	// that matched -basic-auth, to avoid hashing them each time.
+	basicAuthDigest atomic.Value
+
+	// assets gives the hashed filenames of the assets
+	// outside of templates, as the core keeps its own.
+	assets *hashfs.FS
+
+	// clock tells the current time, time.Now when nil.
+	// It is replaced by tests to simulate another time.
+	clock func() time.Time
+
+	// debugLog and errorLog share the destination of the core logger,
+	// which is used for informational messages.
+	debugLog *log.Logger
+	errorLog *log.Logger
+
+	statusService  *StatusService
+	guestService   *GuestService
+	eventService   *EventService
+	commentService *CommentService
+	adminService   *AdminService
+	setupService   *SetupService
+	statsService   *StatsService
+	backupService  *BackupService
+	rsvpService    *RSVPService
 }
 
 func main() {
@@ -68,9 +202,61 @@ func run(args []string, stdout io.Writer) error {
 
 	flagSet.IntVar(&cfg.port, "port", 8080, "http server port")
 	flagSet.StringVar(&cfg.dsn, "dsn", "tdispo.db", "database data source name")
-	flagSet.StringVar(&cfg.sessionKey, "session-key", "xxx", "session key for cookies encryption")
+	flagSet.StringVar(&cfg.sessionKey, "session-key", defaultSessionKey, "session key for cookies encryption, of 32 bytes")
+	flagSet.BoolVar(&cfg.production, "production", false, "refuse to start with an insecure configuration")
 	flagSet.StringVar(&cfg.locale, "locale", "auto", "locale of the application")
+	flagSet.StringVar(&cfg.locales, "locales", "", "comma separated locales offered to visitors, all of them when empty")
+	flagSet.StringVar(&cfg.appName, "app-name", "tdispo", "name of the application displayed in pages")
 	flagSet.StringVar(&cfg.logo, "logo", "tdispo.svg", "path of logo in assets")
+	flagSet.StringVar(&cfg.favicon, "favicon", "favicon.ico", "path of favicon in assets")
+	flagSet.StringVar(&cfg.touchIcon, "touch-icon", "touch-icon.png", "path of the 180x180 png icon in assets shown on the home screen of Apple devices")
+	flagSet.StringVar(&cfg.startURL, "start-url", "/", "page opened when launching the installed application")
+	flagSet.StringVar(&cfg.themeColor, "theme-color", "#2563eb", "color of the browser interface around the application")
+	flagSet.StringVar(&cfg.cookiePrefix, "cookie-prefix", "", "prefix of the names of cookies, to run several instances on the same domain")
+	flagSet.StringVar(&cfg.seed, "seed", "", "path of a json fixtures file to load at startup")
+	flagSet.StringVar(&cfg.logFile, "log-file", "", "path of a file to append logs to, stdout when empty")
+	flagSet.StringVar(&cfg.logLevel, "log-level", LevelInfo, `minimum level of logged messages: "debug", "info" or "error"`)
+	flagSet.IntVar(&cfg.perPage, "per-page", 20, "number of events displayed per page")
+	flagSet.StringVar(&cfg.defaultScope, "default-scope", ScopeUpcoming, `events listed on the home page until guests choose otherwise: "upcoming", "week", "past" or "all"`)
+	flagSet.BoolVar(&cfg.requireStatus, "require-status", true, "require a status on events")
+	flagSet.IntVar(&cfg.maxTitleLength, "max-title-length", 120, "maximum number of characters of event titles")
+	flagSet.IntVar(&cfg.maxDescriptionLength, "max-description-length", 5000, "maximum number of characters of event descriptions")
+	flagSet.DurationVar(&cfg.defaultDuration, "default-duration", 2*time.Hour, "duration of events with no end")
+	flagSet.DurationVar(&cfg.gracePeriod, "grace-period", 0, "duration during which events can still be answered after their end")
+	flagSet.DurationVar(&cfg.refreshInterval, "refresh-interval", 0, "how often the guests of an event are reloaded on its page, 0 to never reload them")
+	flagSet.DurationVar(&cfg.minNotice, "min-notice", 0, "minimum duration between the creation of events and their start, 0 for no limit")
+	flagSet.IntVar(&cfg.maxDaysPast, "max-days-past", 365, "maximum number of days in the past new events can start, 0 for no limit")
+	flagSet.IntVar(&cfg.maxYearsAhead, "max-years-ahead", 5, "maximum number of years in the future new events can start, 0 for no limit")
+	flagSet.StringVar(&cfg.pendingLabel, "pending-label", "Awaiting reply", "label of guests who have not answered an event, translated when possible")
+	flagSet.StringVar(&cfg.ifNeeded, "if-needed", IfNeededSeparate, `how "if needed" responses are counted in summaries: "separate" keeps them apart, "yes" counts them as yes, "no" as no`)
+
+	cfg.location = time.UTC
+	flagSet.Func("timezone", "time zone in which the dates of events are entered, such as Europe/Paris, to tell when they are past (default \"UTC\")", func(s string) (err error) {
+		cfg.location, err = time.LoadLocation(s)
+		return err
+	})
+
+	cfg.listColumns = map[string]bool{"status": true, "participation": true}
+	flagSet.Func("list-columns", "comma separated columns displayed in the list of events among status, participation, attendance and organizer (default \"status,participation\")", func(s string) (err error) {
+		cfg.listColumns, err = parseEventColumns(s)
+		return err
+	})
+
+	flagSet.Func("trusted-proxies", "comma separated IP addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For header is trusted", func(s string) (err error) {
+		cfg.trustedProxies, err = parseTrustedProxies(s)
+		return err
+	})
+
+	flagSet.Func("basic-auth", "user:hash asked for every request, where hash is the bcrypt hash of the password, as produced by htpasswd -nB", func(s string) (err error) {
+		cfg.basicAuthUser, cfg.basicAuthHash, err = parseBasicAuth(s)
+		return err
+	})
+
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: %s [flags] [command]\n\nFlags:\n", args[0])
+		flagSet.PrintDefaults()
+		fmt.Fprintf(flagSet.Output(), "\n%s", commandsUsage)
+	}
 
 	if err := flagSet.Parse(args[1:]); err != nil {
 		return err
@@ -80,22 +266,122 @@ func run(args []string, stdout io.Writer) error {
 		config: cfg,
 	}
 
-	var err error
+	if !IfNeededModes[cfg.ifNeeded] {
+		return fmt.Errorf("invalid -if-needed mode %q", cfg.ifNeeded)
+	}
+
+	if cfg.defaultDuration <= 0 {
+		return fmt.Errorf("invalid -default-duration %s, it must be positive", cfg.defaultDuration)
+	}
 
-	app.Core, err = bow.NewCore(
-		fsys,
-		bow.WithGlobals(app.addGlobals),
-		bow.WithDB(cfg.dsn),
-		bow.WithSession(cfg.sessionKey),
-		bow.WithTranslator(cfg.locale),
-	)
+	if !EventScopes[cfg.defaultScope] {
+		return fmt.Errorf("invalid -default-scope %q", cfg.defaultScope)
+	}
+
+	if !cookiePrefixRX.MatchString(cfg.cookiePrefix) {
+		return fmt.Errorf("invalid -cookie-prefix %q, only letters, digits, dashes and underscores are allowed", cfg.cookiePrefix)
+	}
+
+	if !colorRX.MatchString(cfg.themeColor) {
+		return fmt.Errorf("invalid -theme-color %q", cfg.themeColor)
+	}
+
+	logFile, err := openLogFile(cfg.logFile)
 	if err != nil {
 		return err
 	}
+	defer logFile.Close()
 
-	app.statusService = &StatusService{db: app.DB}
-	app.guestService = &GuestService{db: app.DB}
-	app.eventService = &EventService{db: app.DB}
+	logs, err := newLoggers(logFile, cfg.logLevel)
+	if err != nil {
+		return err
+	}
+
+	app.debugLog = logs.debug
+	app.errorLog = logs.error
+
+	for name, icon := range map[string]string{"favicon": cfg.favicon, "touch-icon": cfg.touchIcon} {
+		if _, err := fs.Stat(fsys, path.Join("assets", icon)); err != nil {
+			return fmt.Errorf("invalid -%s: %w", name, err)
+		}
+	}
+
+	var files fs.FS = fsys
+	if cfg.locales != "" {
+		enabled, err := parseLocales(fsys, cfg.locales)
+		if err != nil {
+			return err
+		}
+
+		if cfg.locale != "auto" && !enabled[cfg.locale] {
+			return fmt.Errorf("locale %q is not among -locales", cfg.locale)
+		}
+
+		files = localesFS{FS: fsys, enabled: enabled}
+	}
+
+	if err := checkDSN(cfg.dsn); err != nil {
+		return err
+	}
+
+	weakKey, err := checkSessionKey(cfg.sessionKey)
+	if err != nil {
+		return err
+	} else if weakKey != "" && cfg.production {
+		return fmt.Errorf("insecure session key: %s", weakKey)
+	}
+
+	app.Core, err = app.newCore(files, logs.info)
+	if err != nil {
+		return err
+	}
+
+	// errors of views are logged whatever the level of the core logger
+	app.Views.Logger = logs.error
+
+	if err := pingDB(context.Background(), app.DB, cfg.dsn); err != nil {
+		return err
+	}
+
+	if err := checkSchema(context.Background(), app.DB); err != nil {
+		return err
+	}
+
+	if weakKey != "" {
+		// written as an error, so that it is logged whatever the level
+		app.errorLog.Printf("WARNING: insecure session key: %s, cookies can be forged; set a random -session-key of %d bytes", weakKey, sessionKeyLength)
+	}
+
+	app.translator = bow.NewTranslator()
+	if err := app.translator.Parse(files); err != nil {
+		return err
+	}
+
+	app.assets = hashfs.NewFS(fsys)
+
+	app.initServices()
+
+	if cfg.seed != "" {
+		f, err := os.Open(cfg.seed)
+		if err != nil {
+			return err
+		}
+
+		err = app.seed(context.Background(), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// run the given command instead of the server
+	if flagSet.NArg() > 0 {
+		err := app.runCommand(context.Background(), flagSet.Args(), os.Stdin, stdout)
+		if cerr := app.DB.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.port),
@@ -111,3 +397,56 @@ func run(args []string, stdout io.Writer) error {
 
 	return app.DB.Close()
 }
+
+// newCore opens the core of the application on the given files,
+// with the database, sessions and translations of the configuration.
+func (app *application) newCore(files fs.FS, logger *log.Logger) (*bow.Core, error) {
+	return bow.NewCore(
+		files,
+		bow.WithLogger(logger),
+		bow.WithGlobals(app.addGlobals),
+		bow.WithFuncs(template.FuncMap{
+			"relative":      app.relativeTime,
+			"highlight":     highlight,
+			"attendChoices": attendChoices,
+			"attendClass":   attendClass,
+		}),
+		withReqFuncs(bow.ReqFuncMap{
+			"attendLabel": app.attendLabel,
+		}),
+		bow.WithDB(withForeignKeys(app.config.dsn)),
+		bow.WithSession(app.config.sessionKey),
+		bow.WithTranslator(app.config.locale),
+	)
+}
+
+// initServices builds the services on top of the database of the core.
+func (app *application) initServices() {
+	cfg := app.config
+
+	app.statusService = &StatusService{db: app.DB, requireStatus: cfg.requireStatus}
+	app.guestService = &GuestService{db: app.DB}
+	app.eventService = &EventService{db: app.DB, defaultDuration: cfg.defaultDuration, gracePeriod: cfg.gracePeriod, ifNeeded: cfg.ifNeeded, location: cfg.location, now: app.clock}
+	app.commentService = &CommentService{db: app.DB}
+	app.adminService = &AdminService{db: app.DB}
+	app.setupService = &SetupService{db: app.DB}
+	app.statsService = &StatsService{db: app.DB, defaultDuration: cfg.defaultDuration, gracePeriod: cfg.gracePeriod, ifNeeded: cfg.ifNeeded, location: cfg.location, now: app.clock}
+	app.backupService = &BackupService{db: app.DB}
+	app.rsvpService = &RSVPService{db: app.DB}
+}
+
+// checkSessionKey makes sure the session key can be used to encrypt cookies.
+// The sessions library silently truncates longer keys, so they are rejected.
+// Weak keys are accepted, but the reason why they are weak is returned.
+func checkSessionKey(key string) (weak string, err error) {
+	switch {
+	case len(key) > sessionKeyLength:
+		return "", fmt.Errorf("the session key must not be longer than %d bytes", sessionKeyLength)
+	case key == defaultSessionKey:
+		return "it is the default one", nil
+	case len(key) < sessionKeyLength:
+		return fmt.Sprintf("it is shorter than %d bytes", sessionKeyLength), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/lobre/bow"
+)
+
+// testSessionKey is a session key of the expected length, only used by tests.
+const testSessionKey = "0123456789abcdef0123456789abcdef"
+
+// newTestApp returns an application with the default configuration
+// on a fresh database, after letting configure change it.
+func newTestApp(t testing.TB, configure func(cfg *config)) *application {
+	t.Helper()
+
+	cfg := config{
+		dsn:                  filepath.Join(t.TempDir(), "tdispo.db"),
+		sessionKey:           testSessionKey,
+		locale:               "auto",
+		appName:              "tdispo",
+		perPage:              20,
+		defaultScope:         ScopeUpcoming,
+		listColumns:          map[string]bool{"status": true, "participation": true},
+		requireStatus:        true,
+		maxTitleLength:       120,
+		maxDescriptionLength: 5000,
+		defaultDuration:      2 * time.Hour,
+		location:             time.UTC,
+		maxDaysPast:          365,
+		maxYearsAhead:        5,
+		ifNeeded:             IfNeededSeparate,
+		pendingLabel:         "Awaiting reply",
+	}
+
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	discard := log.New(io.Discard, "", 0)
+
+	app := &application{
+		config:   cfg,
+		debugLog: discard,
+		errorLog: discard,
+	}
+
+	var err error
+	app.Core, err = app.newCore(fsys, discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.DB.Close() })
+
+	app.translator = bow.NewTranslator()
+	if err := app.translator.Parse(fsys); err != nil {
+		t.Fatal(err)
+	}
+
+	app.assets = hashfs.NewFS(fsys)
+	app.initServices()
+
+	return app
+}
+
+// mustCreateGuest creates a guest with the given name.
+func mustCreateGuest(t testing.TB, app *application, name string) *Guest {
+	t.Helper()
+
+	guest := &Guest{Name: name, Email: strings.ToLower(name) + "@example.com"}
+	if err := app.guestService.CreateGuest(context.Background(), guest); err != nil {
+		t.Fatal(err)
+	}
+
+	return guest
+}
+
+// mustCreateStatus creates a status with the given label.
+func mustCreateStatus(t testing.TB, app *application, label string) *Status {
+	t.Helper()
+
+	status := &Status{Label: label, Color: "blue"}
+	if err := app.statusService.CreateStatus(context.Background(), status); err != nil {
+		t.Fatal(err)
+	}
+
+	return status
+}
+
+// mustCreateEvent creates an event with the given title starting at the given time.
+func mustCreateEvent(t testing.TB, app *application, title string, startsAt time.Time) *Event {
+	t.Helper()
+
+	event := &Event{Title: title, StartsAt: startsAt}
+	if err := app.eventService.CreateEvent(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
+
+// mustFindParticipations returns the participations stored for an event.
+func mustFindParticipations(t testing.TB, app *application, eventID int) []*Participation {
+	t.Helper()
+
+	var parts []*Participation
+	err := withTx(context.Background(), app.DB, func(tx *sql.Tx) (err error) {
+		parts, _, err = findParticipations(context.Background(), tx, ParticipationFilter{EventID: &eventID})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parts
+}
+
+// testClient sends requests to a test server of the application,
+// keeping the cookies of the session and passing the CSRF check.
+type testClient struct {
+	t      testing.TB
+	srv    *httptest.Server
+	client *http.Client
+}
+
+// newTestClient starts a test server of the application and returns
+// a client having received a CSRF cookie, but not recognized yet.
+func newTestClient(t testing.TB, app *application) *testClient {
+	t.Helper()
+
+	srv := httptest.NewServer(app.routes())
+	t.Cleanup(srv.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testClient{
+		t:   t,
+		srv: srv,
+		client: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	c.do(http.MethodGet, "/whoareyou", nil, nil)
+
+	return c
+}
+
+// asAdmin enters the admin mode, which needs no password without accounts.
+func (c *testClient) asAdmin() *testClient {
+	c.t.Helper()
+
+	if code, _ := c.do(http.MethodGet, "/admin", nil, nil); code != http.StatusSeeOther {
+		c.t.Fatalf("entering the admin mode: got status %d", code)
+	}
+
+	return c
+}
+
+// asGuest recognizes the client as the given guest.
+func (c *testClient) asGuest(id int) *testClient {
+	c.t.Helper()
+
+	if code, _ := c.do(http.MethodPost, fmt.Sprintf("/iam/%d", id), url.Values{}, nil); code != http.StatusSeeOther {
+		c.t.Fatalf("recognizing guest %d: got status %d", id, code)
+	}
+
+	return c
+}
+
+// csrfToken returns the token of the CSRF cookie, masked as expected in
+// requests. The mask is made of zeros, which leaves the token as it is.
+func (c *testClient) csrfToken() string {
+	u, _ := url.Parse(c.srv.URL)
+	for _, cookie := range c.client.Jar.Cookies(u) {
+		if cookie.Name == "csrf_token" {
+			token, err := base64.StdEncoding.DecodeString(cookie.Value)
+			if err != nil {
+				return ""
+			}
+			return base64.StdEncoding.EncodeToString(append(make([]byte, len(token)), token...))
+		}
+	}
+
+	return ""
+}
+
+// do sends a request with the given form, if not nil, and headers,
+// which take precedence over the ones set by default.
+// It returns the status and the body of the response.
+func (c *testClient) do(method, path string, form url.Values, header http.Header) (int, string) {
+	c.t.Helper()
+
+	if form == nil {
+		return c.send(method, path, nil, header)
+	}
+
+	h := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	for name, values := range header {
+		h[name] = values
+	}
+
+	return c.send(method, path, strings.NewReader(form.Encode()), h)
+}
+
+// send sends a request with the given body and headers, which take
+// precedence over the CSRF token. It returns the status and the body of
+// the response. As it can be called by several goroutines, failures are
+// reported without stopping the test.
+func (c *testClient) send(method, path string, body io.Reader, header http.Header) (int, string) {
+	c.t.Helper()
+
+	req, err := http.NewRequest(method, c.srv.URL+path, body)
+	if err != nil {
+		c.t.Error(err)
+		return 0, ""
+	}
+
+	req.Header.Set("X-CSRF-Token", c.csrfToken())
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Error(err)
+		return 0, ""
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Error(err)
+		return 0, ""
+	}
+
+	return resp.StatusCode, string(b)
+}
+
+func TestRunRejectsNonPositiveDefaultDuration(t *testing.T) {
+	for _, d := range []string{"0", "-1h"} {
+		err := run([]string{"tdispo", "-dsn", filepath.Join(t.TempDir(), "tdispo.db"), "-default-duration", d}, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "-default-duration") {
+			t.Errorf("-default-duration %s: got error %v", d, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"path"
+)
+
+// webManifest is the web app manifest allowing to install
+// the application on the home screen of phones.
+type webManifest struct {
+	Name            string         `json:"name"`
+	ShortName       string         `json:"short_name"`
+	StartURL        string         `json:"start_url"`
+	Display         string         `json:"display"`
+	BackgroundColor string         `json:"background_color"`
+	ThemeColor      string         `json:"theme_color"`
+	Icons           []manifestIcon `json:"icons"`
+}
+
+type manifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// manifest serves the web app manifest. Icons reference the hashed
+// filenames of the assets, so that updated icons are picked up.
+func (app *application) manifest(w http.ResponseWriter, r *http.Request) {
+	icon := path.Join("assets", app.config.logo)
+
+	m := webManifest{
+		Name:            app.config.appName,
+		ShortName:       app.config.appName,
+		StartURL:        app.config.startURL,
+		Display:         "standalone",
+		BackgroundColor: "#f3f4f6",
+		ThemeColor:      app.config.themeColor,
+		Icons: []manifestIcon{
+			{
+				Src:   "/" + app.assets.HashName(icon),
+				Sizes: "any",
+				Type:  mime.TypeByExtension(path.Ext(icon)),
+			},
+		},
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/manifest+json")
+	json.NewEncoder(w).Encode(m)
+}
@@ -0,0 +1,8 @@
+ALTER TABLE events ADD COLUMN created_at DATETIME DEFAULT NULL;
+ALTER TABLE events ADD COLUMN updated_at DATETIME DEFAULT NULL;
+
+ALTER TABLE guests ADD COLUMN feed_token TEXT DEFAULT NULL;
+
+UPDATE guests SET feed_token = lower(hex(randomblob(16)));
+
+CREATE UNIQUE INDEX guests_feed_token ON guests (feed_token);
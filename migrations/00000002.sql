@@ -0,0 +1,11 @@
+CREATE TABLE event_attachments (
+  id           INTEGER PRIMARY KEY,
+  event_id     INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  filename     TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size         INTEGER NOT NULL,
+  data         BLOB NOT NULL,
+  created_at   DATETIME NOT NULL
+);
+
+CREATE INDEX event_attachments_event_id ON event_attachments (event_id);
@@ -0,0 +1,9 @@
+CREATE TABLE comments (
+  id         INTEGER PRIMARY KEY,
+  event_id   INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  guest_id   INTEGER NOT NULL REFERENCES guests (id) ON DELETE CASCADE,
+  body       TEXT NOT NULL,
+  created_at DATETIME NOT NULL
+);
+
+CREATE INDEX comments_event_id ON comments (event_id);
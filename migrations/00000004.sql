@@ -0,0 +1,2 @@
+ALTER TABLE statuses ADD COLUMN description TEXT DEFAULT NULL;
+ALTER TABLE statuses ADD COLUMN icon TEXT DEFAULT NULL; -- short text such as an emoji
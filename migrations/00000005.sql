@@ -0,0 +1 @@
+ALTER TABLE guests ADD COLUMN theme TEXT NOT NULL DEFAULT 'auto'; -- light, dark or auto
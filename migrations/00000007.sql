@@ -0,0 +1,6 @@
+CREATE TABLE event_covers (
+  event_id     INTEGER PRIMARY KEY REFERENCES events (id) ON DELETE CASCADE,
+  name         TEXT NOT NULL, -- filename containing the hash of the data
+  content_type TEXT NOT NULL,
+  data         BLOB NOT NULL
+);
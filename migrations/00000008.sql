@@ -0,0 +1,7 @@
+CREATE TABLE event_fields (
+  event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  key      TEXT NOT NULL,
+  value    TEXT NOT NULL,
+
+  PRIMARY KEY (event_id, key)
+);
@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN responses_open_at DATETIME DEFAULT NULL;
@@ -0,0 +1,91 @@
+-- SQLite cannot drop the NOT NULL constraint of a column, so the events
+-- table is rebuilt. As renaming a table also renames it in the foreign keys
+-- pointing to it, the tables referencing events are rebuilt as well.
+-- Otherwise, dropping the old events table would cascade to them.
+ALTER TABLE events RENAME TO events_old;
+
+CREATE TABLE events (
+  id                INTEGER PRIMARY KEY,
+  title             TEXT NOT NULL,
+  starts_at         DATETIME NOT NULL,
+  ends_at           DATETIME DEFAULT NULL,
+  description       TEXT DEFAULT NULL,
+  status            INTEGER DEFAULT NULL REFERENCES statuses (id),
+  created_at        DATETIME DEFAULT NULL,
+  updated_at        DATETIME DEFAULT NULL,
+  responses_open_at DATETIME DEFAULT NULL
+);
+
+INSERT INTO events SELECT id, title, starts_at, ends_at, description, status, created_at, updated_at, responses_open_at FROM events_old;
+
+ALTER TABLE participations RENAME TO participations_old;
+
+CREATE TABLE participations (
+  guest_id INTEGER NOT NULL REFERENCES guests (id) ON DELETE CASCADE,
+  event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  attend   INTEGER DEFAULT NULL,
+
+  PRIMARY KEY (guest_id, event_id)
+);
+
+INSERT INTO participations SELECT guest_id, event_id, attend FROM participations_old;
+DROP TABLE participations_old;
+
+ALTER TABLE event_attachments RENAME TO event_attachments_old;
+
+CREATE TABLE event_attachments (
+  id           INTEGER PRIMARY KEY,
+  event_id     INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  filename     TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size         INTEGER NOT NULL,
+  data         BLOB NOT NULL,
+  created_at   DATETIME NOT NULL
+);
+
+INSERT INTO event_attachments SELECT id, event_id, filename, content_type, size, data, created_at FROM event_attachments_old;
+DROP TABLE event_attachments_old;
+
+CREATE INDEX event_attachments_event_id ON event_attachments (event_id);
+
+ALTER TABLE comments RENAME TO comments_old;
+
+CREATE TABLE comments (
+  id         INTEGER PRIMARY KEY,
+  event_id   INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  guest_id   INTEGER NOT NULL REFERENCES guests (id) ON DELETE CASCADE,
+  body       TEXT NOT NULL,
+  created_at DATETIME NOT NULL
+);
+
+INSERT INTO comments SELECT id, event_id, guest_id, body, created_at FROM comments_old;
+DROP TABLE comments_old;
+
+CREATE INDEX comments_event_id ON comments (event_id);
+
+ALTER TABLE event_covers RENAME TO event_covers_old;
+
+CREATE TABLE event_covers (
+  event_id     INTEGER PRIMARY KEY REFERENCES events (id) ON DELETE CASCADE,
+  name         TEXT NOT NULL, -- filename containing the hash of the data
+  content_type TEXT NOT NULL,
+  data         BLOB NOT NULL
+);
+
+INSERT INTO event_covers SELECT event_id, name, content_type, data FROM event_covers_old;
+DROP TABLE event_covers_old;
+
+ALTER TABLE event_fields RENAME TO event_fields_old;
+
+CREATE TABLE event_fields (
+  event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  key      TEXT NOT NULL,
+  value    TEXT NOT NULL,
+
+  PRIMARY KEY (event_id, key)
+);
+
+INSERT INTO event_fields SELECT event_id, key, value FROM event_fields_old;
+DROP TABLE event_fields_old;
+
+DROP TABLE events_old;
@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN created_by INTEGER DEFAULT NULL REFERENCES guests (id) ON DELETE SET NULL;
@@ -0,0 +1,13 @@
+CREATE TABLE admins (
+  id            INTEGER PRIMARY KEY,
+  username      TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL,
+  disabled      INTEGER NOT NULL DEFAULT 0,
+  created_at    DATETIME NOT NULL
+);
+
+-- the former single admin password becomes the bootstrap account
+INSERT INTO admins (username, password_hash, created_at)
+  SELECT 'admin', value, CURRENT_TIMESTAMP FROM settings WHERE key = 'admin_password';
+
+DELETE FROM settings WHERE key = 'admin_password';
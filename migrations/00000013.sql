@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN all_day INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+CREATE TABLE event_changes (
+  id         INTEGER PRIMARY KEY,
+  event_id   INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  field      TEXT NOT NULL,
+  old_value  TEXT,
+  new_value  TEXT,
+  actor      TEXT,
+  changed_at DATETIME NOT NULL
+);
+
+CREATE INDEX event_changes_event_id ON event_changes (event_id);
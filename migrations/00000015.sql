@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN cancelled_at DATETIME DEFAULT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE guests ADD COLUMN link_token TEXT DEFAULT NULL;
+
+UPDATE guests SET link_token = lower(hex(randomblob(16)));
+
+CREATE UNIQUE INDEX guests_link_token ON guests (link_token);
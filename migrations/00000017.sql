@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN default_no BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN min_attendees INTEGER DEFAULT NULL;
+ALTER TABLE events ADD COLUMN max_attendees INTEGER DEFAULT NULL;
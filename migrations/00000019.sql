@@ -0,0 +1,6 @@
+CREATE TABLE rsvp_tokens (
+  event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+  guest_id INTEGER NOT NULL REFERENCES guests (id) ON DELETE CASCADE,
+  token    TEXT NOT NULL UNIQUE,
+  PRIMARY KEY (event_id, guest_id)
+);
@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"strings"
+	"time"
 )
 
 const (
@@ -18,6 +19,69 @@ var AttendText = map[int64]string{
 	AttendIfNeeded: "if needed",
 }
 
+// NoAnswerText is the label of guests who haven’t answered.
+const NoAnswerText = "no answer"
+
+// AttendClass are the CSS classes displaying each answer.
+var AttendClass = map[int64]string{
+	AttendNo:       "text-red-600",
+	AttendYes:      "text-green-600",
+	AttendIfNeeded: "text-yellow-600",
+}
+
+// NoAnswerClass are the CSS classes displaying the lack of answer.
+const NoAnswerClass = "text-gray-500"
+
+// attendChoices returns the answers guests can give, in the order they are offered.
+func attendChoices() []sql.NullInt64 {
+	return []sql.NullInt64{
+		{Int64: AttendNo, Valid: true},
+		{Int64: AttendYes, Valid: true},
+		{Int64: AttendIfNeeded, Valid: true},
+	}
+}
+
+// attendClass returns the CSS classes displaying an answer.
+func attendClass(attend sql.NullInt64) string {
+	if !attend.Valid {
+		return NoAnswerClass
+	}
+	return AttendClass[attend.Int64]
+}
+
+// IfNeededModes are the ways "if needed" responses can be counted in
+// summaries, such as the counts of the roster, the attendance sort
+// and the statistics. They are either kept apart from the other
+// responses, counted as yes, or counted as no.
+var IfNeededModes = map[string]bool{
+	IfNeededSeparate: true,
+	IfNeededAsYes:    true,
+	IfNeededAsNo:     true,
+}
+
+const (
+	IfNeededSeparate = "separate"
+	IfNeededAsYes    = "yes"
+	IfNeededAsNo     = "no"
+)
+
+// countedAttend returns the response under which attend
+// is counted in summaries with the given "if needed" mode.
+func countedAttend(attend int64, ifNeeded string) int64 {
+	if attend != AttendIfNeeded {
+		return attend
+	}
+
+	switch ifNeeded {
+	case IfNeededAsYes:
+		return AttendYes
+	case IfNeededAsNo:
+		return AttendNo
+	}
+
+	return attend
+}
+
 type Participation struct {
 	GuestID int
 	Guest   *Guest
@@ -26,68 +90,72 @@ type Participation struct {
 	Event   *Event
 
 	Attend sql.NullInt64
+
+	// Assumed is true when the guest hasn’t answered,
+	// and Attend is the default answer of the event.
+	Assumed bool
 }
 
-// findParticipationsByEvent fetches the participations related to a specific event.
-// For each participation, the guest is attached.
-func findParticipationsByEvent(ctx context.Context, tx *sql.Tx, id int) (_ []*Participation, n int, err error) {
-	rows, err := tx.QueryContext(ctx,
-		`SELECT
-			guest_id,
-			event_id,
-			attend,
-			COUNT(*) OVER()
-		FROM participations
-		WHERE event_id = ?`,
-		id,
-	)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer rows.Close()
+// ParticipationFilter selects participations. All the set fields must match.
+type ParticipationFilter struct {
+	EventID *int
+	GuestID *int
+	Attend  *int64
 
-	participations := make([]*Participation, 0)
+	// From and To keep the participations to
+	// the events starting within this window.
+	From *time.Time
+	To   *time.Time
 
-	for rows.Next() {
-		var part Participation
+	// Limit caps the number of returned participations when
+	// positive. The returned count still reflects all of them.
+	Limit int
+}
 
-		err = rows.Scan(&part.GuestID, &part.EventID, &part.Attend, &n)
-		if err != nil {
-			return nil, 0, err
-		}
+// findParticipations fetches the participations matching the filter, from the most
+// recent event to the oldest. The guest of each participation is attached, unless
+// the filter is on a guest, and so is the event, unless the filter is on an event,
+// as the caller already has them. Participations of removed guests or events are skipped.
+func findParticipations(ctx context.Context, tx *sql.Tx, filter ParticipationFilter) (_ []*Participation, n int, err error) {
+	where, args := []string{"1 = 1"}, []interface{}{}
+	if filter.EventID != nil {
+		where, args = append(where, "participations.event_id = ?"), append(args, *filter.EventID)
+	}
 
-		// attach guest
-		part.Guest, err = findGuestByID(ctx, tx, part.GuestID)
-		if err != nil {
-			if errors.Is(err, ErrNoRecord) {
-				// guest has been removed, skip
-				continue
-			}
-			return nil, 0, err
-		}
+	if filter.GuestID != nil {
+		where, args = append(where, "participations.guest_id = ?"), append(args, *filter.GuestID)
+	}
 
-		participations = append(participations, &part)
+	if filter.Attend != nil {
+		where, args = append(where, "participations.attend = ?"), append(args, *filter.Attend)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, 0, err
+	if filter.From != nil {
+		where, args = append(where, "datetime(events.starts_at) >= datetime(?)"), append(args, filter.From.UTC().Format(layoutSQLite))
 	}
 
-	return participations, n, nil
-}
+	if filter.To != nil {
+		where, args = append(where, "datetime(events.starts_at) < datetime(?)"), append(args, filter.To.UTC().Format(layoutSQLite))
+	}
+
+	limit := ""
+	if filter.Limit > 0 {
+		limit, args = "LIMIT ?", append(args, filter.Limit)
+	}
 
-// findParticipationsByGuest fetches the participations related to a specific guest.
-// For each participation, the event is attached.
-func findParticipationsByGuest(ctx context.Context, tx *sql.Tx, id int) (_ []*Participation, n int, err error) {
 	rows, err := tx.QueryContext(ctx,
 		`SELECT
-			guest_id,
-			event_id,
-			attend,
+			participations.guest_id,
+			participations.event_id,
+			participations.attend,
 			COUNT(*) OVER()
 		FROM participations
-		WHERE guest_id = ?`,
-		id,
+		JOIN events ON events.id = participations.event_id
+		JOIN guests ON guests.id = participations.guest_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY events.starts_at DESC, guests.name
+		`+limit,
+		args...,
 	)
 	if err != nil {
 		return nil, 0, err
@@ -104,16 +172,6 @@ func findParticipationsByGuest(ctx context.Context, tx *sql.Tx, id int) (_ []*Pa
 			return nil, 0, err
 		}
 
-		// attach event
-		part.Event, err = findEventByID(ctx, tx, part.EventID)
-		if err != nil {
-			if errors.Is(err, ErrNoRecord) {
-				// event has been removed, skip
-				continue
-			}
-			return nil, 0, err
-		}
-
 		participations = append(participations, &part)
 	}
 
@@ -121,6 +179,23 @@ func findParticipationsByGuest(ctx context.Context, tx *sql.Tx, id int) (_ []*Pa
 		return nil, 0, err
 	}
 
+	// attach guests and events once the rows are closed
+	for _, part := range participations {
+		if filter.GuestID == nil {
+			part.Guest, err = findGuestByID(ctx, tx, part.GuestID)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if filter.EventID == nil {
+			part.Event, err = findEventByID(ctx, tx, part.EventID)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
 	return participations, n, nil
 }
 
@@ -138,13 +213,21 @@ func attachUnansweredGuests(ctx context.Context, tx *sql.Tx, event *Event) error
 		return err
 	}
 
-	// Add participations with attend that equals no answer for pending guests
+	// Add participations with attend that equals no answer for pending guests,
+	// or no when the event counts them as such
 	for _, guest := range pending {
-		event.Participations = append(event.Participations, &Participation{
+		part := Participation{
 			Guest:  guest,
 			Event:  event,
 			Attend: sql.NullInt64{},
-		})
+		}
+
+		if event.PendingAsNo() {
+			part.Attend = sql.NullInt64{Int64: AttendNo, Valid: true}
+			part.Assumed = true
+		}
+
+		event.Participations = append(event.Participations, &part)
 	}
 
 	return nil
@@ -176,7 +259,8 @@ func attachUnansweredEvents(ctx context.Context, tx *sql.Tx, guest *Guest) error
 	return nil
 }
 
-func participate(ctx context.Context, tx *sql.Tx, part *Participation) error {
+// upsertParticipation creates or replaces the answer of a guest to an event.
+func upsertParticipation(ctx context.Context, tx *sql.Tx, part *Participation) error {
 	_, err := tx.ExecContext(ctx,
 		`INSERT OR REPLACE INTO participations (guest_id, event_id, attend) VALUES (?, ?, ?)`,
 		part.GuestID,
@@ -191,8 +275,63 @@ func participate(ctx context.Context, tx *sql.Tx, part *Participation) error {
 }
 
 // ByGuestName implements sort.Interface based on the Name field of the Guest.
+// Guests who answered come first, followed by the ones who haven’t yet,
+// including those whose answer is only assumed.
 type ByGuestName []*Participation
 
-func (parts ByGuestName) Len() int           { return len(parts) }
-func (parts ByGuestName) Less(i, j int) bool { return parts[i].Guest.Name < parts[j].Guest.Name }
-func (parts ByGuestName) Swap(i, j int)      { parts[i], parts[j] = parts[j], parts[i] }
+func (parts ByGuestName) Len() int      { return len(parts) }
+func (parts ByGuestName) Swap(i, j int) { parts[i], parts[j] = parts[j], parts[i] }
+
+func (parts ByGuestName) Less(i, j int) bool {
+	answeredI := parts[i].Attend.Valid && !parts[i].Assumed
+	answeredJ := parts[j].Attend.Valid && !parts[j].Assumed
+	if answeredI != answeredJ {
+		return answeredI
+	}
+	return parts[i].Guest.Name < parts[j].Guest.Name
+}
+
+// deleteParticipation removes the participation of a guest to an event,
+// so that the guest falls back to not having answered.
+func deleteParticipation(ctx context.Context, tx *sql.Tx, eventID, guestID int) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM participations WHERE event_id = ? AND guest_id = ?`, eventID, guestID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deleteOrphanParticipations deletes the participations whose guest or event
+// no longer exists, and returns them.
+func deleteOrphanParticipations(ctx context.Context, tx *sql.Tx) ([]*Participation, error) {
+	const orphan = `guest_id NOT IN (SELECT id FROM guests) OR event_id NOT IN (SELECT id FROM events)`
+
+	rows, err := tx.QueryContext(ctx, `SELECT guest_id, event_id, attend FROM participations WHERE `+orphan+` ORDER BY event_id, guest_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participations := make([]*Participation, 0)
+
+	for rows.Next() {
+		var part Participation
+
+		if err := rows.Scan(&part.GuestID, &part.EventID, &part.Attend); err != nil {
+			return nil, err
+		}
+
+		participations = append(participations, &part)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM participations WHERE `+orphan); err != nil {
+		return nil, err
+	}
+
+	return participations, nil
+}
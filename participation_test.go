@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkedRX finds the answer checked in the participation of a guest.
+var checkedRX = regexp.MustCompile(`id="attend_(\d+)"\s+checked`)
+
+func TestParticipateConcurrently(t *testing.T) {
+	app := newTestApp(t, nil)
+	guest := mustCreateGuest(t, app, "Alice")
+	event := mustCreateEvent(t, app, "Rehearsal", time.Now().Add(48*time.Hour))
+
+	c := newTestClient(t, app).asGuest(guest.ID)
+
+	const workers, requests = 8, 10
+
+	path := fmt.Sprintf("/%d/participation/%d", event.ID, guest.ID)
+	header := http.Header{"Accept": {"text/vnd.turbo-stream.html"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < requests; j++ {
+				attend := (i + j) % len(AttendText)
+
+				code, body := c.do(http.MethodPut, path, url.Values{"attend": {strconv.Itoa(attend)}}, header)
+				if code != http.StatusOK {
+					t.Errorf("answering %d: got status %d", attend, code)
+					continue
+				}
+
+				// the stream must show the answer just written,
+				// whatever the other requests have done meanwhile
+				checked := checkedRX.FindAllStringSubmatch(body, -1)
+				if len(checked) != 1 || checked[0][1] != strconv.Itoa(attend) {
+					t.Errorf("answering %d: got checked answers %v", attend, checked)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	parts := mustFindParticipations(t, app, event.ID)
+	if len(parts) != 1 {
+		t.Fatalf("got %d participations, want 1", len(parts))
+	}
+	if parts[0].GuestID != guest.ID || !parts[0].Attend.Valid {
+		t.Fatalf("got participation %+v, want an answer of guest %d", parts[0], guest.ID)
+	}
+
+	event, err := app.eventService.FindEventByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var answered int
+	for _, part := range event.Participations {
+		if part.Attend.Valid {
+			answered++
+		}
+	}
+	if answered != 1 {
+		t.Errorf("got %d answers on the event, want 1", answered)
+	}
+}
+
+func TestByGuestNameGroupsAnswered(t *testing.T) {
+	answer := func(name string, attend int64) *Participation {
+		return &Participation{Guest: &Guest{Name: name}, Attend: sql.NullInt64{Int64: attend, Valid: true}}
+	}
+	pending := func(name string) *Participation {
+		return &Participation{Guest: &Guest{Name: name}}
+	}
+	assumed := func(name string) *Participation {
+		return &Participation{Guest: &Guest{Name: name}, Attend: sql.NullInt64{Int64: AttendNo, Valid: true}, Assumed: true}
+	}
+
+	parts := []*Participation{
+		pending("Alice"),
+		answer("Dave", AttendNo),
+		assumed("Bob"),
+		answer("Carol", AttendYes),
+		pending("Eve"),
+		answer("Bill", AttendIfNeeded),
+	}
+
+	sort.Sort(ByGuestName(parts))
+
+	var names []string
+	for _, part := range parts {
+		names = append(names, part.Guest.Name)
+	}
+
+	want := "Bill Carol Dave Alice Bob Eve"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -4,44 +4,122 @@ import (
 	"net/http"
 
 	"github.com/bmizerany/pat"
+	"github.com/justinas/alice"
 )
 
 func (app *application) routes() http.Handler {
-	chain := app.DynChain().Append(app.recognizeGuest)
+	chain := app.DynChain().Append(app.recognizeGuest, app.recognizeAdmin)
+
+	// api is the chain of the routes changing data without forms,
+	// which have no CSRF token to send and check their caller themselves
+	api := alice.New(limitBody(maxAPIBodySize), app.Session.Enable, app.recognizeGuest, app.recognizeAdmin)
 
 	mux := pat.New()
 
-	mux.Get("/assets/", app.FileServer())
+	mux.Get("/assets/", cacheAssets(app.FileServer()))
+	mux.Get("/favicon.ico", app.serveIcon(app.config.favicon))
+	mux.Get("/apple-touch-icon.png", app.serveIcon(app.config.touchIcon))
+	mux.Get("/apple-touch-icon-precomposed.png", app.serveIcon(app.config.touchIcon))
+	mux.Get("/manifest.webmanifest", chain.ThenFunc(app.manifest))
 
 	// cookie authentication
 	mux.Get("/whoareyou", chain.ThenFunc(app.whoAreYou))
+	mux.Get("/whoareyou/search", chain.ThenFunc(app.whoAreYouSearch))
 	mux.Post("/iam/:id", chain.ThenFunc(app.iAm))
+	mux.Get("/g/:token", chain.ThenFunc(app.iAmLink))
+	mux.Get("/rsvp/:token", chain.ThenFunc(app.rsvpForm))
+	mux.Post("/rsvp/:token", chain.ThenFunc(app.rsvp))
+	mux.Get("/setup", chain.ThenFunc(app.setupForm))
+	mux.Post("/setup", chain.ThenFunc(app.setup))
 	mux.Get("/admin", chain.ThenFunc(app.admin))
+	mux.Post("/admin", chain.ThenFunc(app.login))
 	mux.Get("/noadmin", chain.Append(app.requireAdmin).ThenFunc(app.noAdmin))
+	mux.Post("/impersonate/:id", chain.Append(app.requireAdmin).ThenFunc(app.impersonate))
+	mux.Post("/stop-impersonate", chain.ThenFunc(app.stopImpersonate))
+
+	// admins
+	mux.Get("/admins", chain.Append(app.requireAdmin).ThenFunc(app.findAdmins))
+	mux.Get("/admins/new", chain.Append(app.requireAdmin).ThenFunc(app.createAdminForm))
+	mux.Post("/admins/new", chain.Append(app.requireAdmin).ThenFunc(app.createAdmin))
+	mux.Post("/admins/:id/disable", chain.Append(app.requireAdmin).ThenFunc(app.disableAdmin))
+	mux.Post("/admins/:id/enable", chain.Append(app.requireAdmin).ThenFunc(app.enableAdmin))
+
+	// backup
+	mux.Get("/backup", chain.Append(app.requireAdmin).ThenFunc(app.backupForm))
+	mux.Get("/export.json", chain.Append(app.requireAdmin).ThenFunc(app.exportBackup))
+	mux.Post("/import.json", alice.New(limitBody(maxBackupSize+1<<20)).Extend(chain).Append(app.requireAdmin).ThenFunc(app.importBackup))
+
+	mux.Post("/theme", chain.Append(requireRecognition).ThenFunc(app.setTheme))
+	mux.Get("/me/profile", chain.Append(requireRecognition).ThenFunc(app.profileForm))
+	mux.Post("/me/profile", chain.Append(requireRecognition).ThenFunc(app.updateProfile))
+	mux.Post("/me/rotate-tokens", chain.Append(requireRecognition).ThenFunc(app.rotateMyTokens))
 
 	// status
 	mux.Get("/status", chain.Append(app.requireAdmin).ThenFunc(app.findStatuses))
 	mux.Get("/status/new", chain.Append(app.requireAdmin).ThenFunc(app.createStatusForm))
 	mux.Post("/status/new", chain.Append(app.requireAdmin).ThenFunc(app.createStatus))
+	mux.Post("/status/defaults", chain.Append(app.requireAdmin).ThenFunc(app.seedStatuses))
 	mux.Del("/status/:id", chain.Append(app.requireAdmin).ThenFunc(app.deleteStatus))
 
 	// guests
 	mux.Get("/guests", chain.Append(app.requireAdmin).ThenFunc(app.findGuests))
+	mux.Get("/guests/clean", chain.Append(app.requireAdmin).ThenFunc(app.cleanParticipationsForm))
+	mux.Post("/guests/clean", chain.Append(app.requireAdmin).ThenFunc(app.cleanParticipations))
 	mux.Get("/guests/new", chain.Append(app.requireAdmin).ThenFunc(app.createGuestForm))
 	mux.Post("/guests/new", chain.Append(app.requireAdmin).ThenFunc(app.createGuest))
 	mux.Get("/guests/:id/edit", chain.Append(app.requireAdmin).ThenFunc(app.updateGuestForm))
 	mux.Post("/guests/:id/edit", chain.Append(app.requireAdmin).ThenFunc(app.updateGuest))
+	mux.Post("/guests/:id/rotate-tokens", chain.Append(app.requireAdmin).ThenFunc(app.rotateTokens))
 	mux.Del("/guests/:id", chain.Append(app.requireAdmin).ThenFunc(app.deleteGuest))
 
+	// stats
+	mux.Get("/stats", chain.Append(app.requireAdmin).ThenFunc(app.stats))
+
+	// api
+	mux.Get("/api/events/:id", chain.ThenFunc(app.apiFindEvent))
+	mux.Patch("/api/events/:id", api.ThenFunc(app.apiUpdateEvent))
+
+	// feeds
+	mux.Get("/feed.atom", chain.ThenFunc(app.feed))
+
 	// events
 	mux.Get("/", chain.Append(requireRecognition).ThenFunc(app.findEvents))
+	mux.Get("/agenda", chain.Append(requireRecognition).ThenFunc(app.agenda))
 	mux.Get("/new", chain.Append(app.requireAdmin).ThenFunc(app.createEventForm))
 	mux.Post("/new", chain.Append(app.requireAdmin).ThenFunc(app.createEvent))
 	mux.Put("/:event/participation/:guest", chain.Append(requireRecognition).ThenFunc(app.participate))
+	mux.Del("/:event/participation/:guest", chain.Append(requireRecognition).ThenFunc(app.clearParticipation))
+	mux.Post("/:id/attachments", alice.New(limitBody(maxAttachmentSize+1<<20)).Extend(chain).Append(app.requireAdmin).ThenFunc(app.createAttachment))
+	mux.Get("/:id/attachments/:attachment", chain.Append(requireRecognition).ThenFunc(app.findAttachment))
+	mux.Del("/:id/attachments/:attachment", chain.Append(app.requireAdmin).ThenFunc(app.deleteAttachment))
+	mux.Post("/:id/cover", alice.New(limitBody(maxCoverSize+1<<20)).Extend(chain).Append(app.requireAdmin).ThenFunc(app.setCover))
+	mux.Get("/:id/cover/:name", chain.Append(requireRecognition).ThenFunc(app.findCover))
+	mux.Del("/:id/cover", chain.Append(app.requireAdmin).ThenFunc(app.deleteCover))
+	mux.Post("/:id/comments", chain.Append(requireRecognition).ThenFunc(app.createComment))
+	mux.Del("/:id/comments/:comment", chain.Append(requireRecognition).ThenFunc(app.deleteComment))
+	mux.Get("/:id/participation.csv", chain.Append(app.requireAdmin).ThenFunc(app.exportParticipations))
+	mux.Get("/:id/participations", chain.Append(app.requireAdmin).ThenFunc(app.participateAllForm))
+	mux.Post("/:id/participations", chain.Append(app.requireAdmin).ThenFunc(app.participateAll))
+	mux.Get("/:id/rsvp", chain.Append(app.requireAdmin).ThenFunc(app.rsvpLinks))
+	mux.Post("/:id/rsvp/:guest", chain.Append(app.requireAdmin).ThenFunc(app.rotateRSVP))
+	mux.Post("/:id/cancel", chain.Append(app.requireAdmin).ThenFunc(app.cancelEvent))
+	mux.Post("/:id/uncancel", chain.Append(app.requireAdmin).ThenFunc(app.uncancelEvent))
+	mux.Get("/:id/roster", chain.Append(requireRecognition).ThenFunc(app.findRoster))
 	mux.Get("/:id/edit", chain.Append(app.requireAdmin).ThenFunc(app.updateEventForm))
 	mux.Post("/:id/edit", chain.Append(app.requireAdmin).ThenFunc(app.updateEvent))
 	mux.Get("/:id", chain.Append(requireRecognition).ThenFunc(app.findEventByID))
 	mux.Del("/:id", chain.Append(app.requireAdmin).ThenFunc(app.deleteEvent))
 
-	return app.StdChain().Then(mux)
+	std := alice.New(app.realIP)
+	if app.config.cookiePrefix != "" {
+		std = std.Append(prefixCookies(app.config.cookiePrefix))
+	}
+	std = std.Extend(app.StdChain())
+
+	// after the standard chain, so that rejected requests are logged too
+	if app.config.basicAuthUser != "" {
+		std = std.Append(app.basicAuth)
+	}
+
+	return std.Then(mux)
 }
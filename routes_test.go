@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeleteRequiresCSRFToken(t *testing.T) {
+	app := newTestApp(t, nil)
+	guest := mustCreateGuest(t, app, "Alice")
+	status := mustCreateStatus(t, app, "Confirmed")
+	mustCreateStatus(t, app, "Cancelled")
+	event := mustCreateEvent(t, app, "Rehearsal", time.Date(2030, 6, 1, 18, 30, 0, 0, time.UTC))
+
+	ctx := context.Background()
+
+	tests := []struct {
+		path string
+		find func() error
+	}{
+		{fmt.Sprintf("/%d", event.ID), func() error {
+			_, err := app.eventService.FindEventByID(ctx, event.ID)
+			return err
+		}},
+		{fmt.Sprintf("/guests/%d", guest.ID), func() error {
+			_, err := app.guestService.FindGuestByID(ctx, guest.ID, GuestHistory{})
+			return err
+		}},
+		{fmt.Sprintf("/status/%d", status.ID), func() error {
+			_, err := app.statusService.FindStatusByID(ctx, status.ID)
+			return err
+		}},
+	}
+
+	c := newTestClient(t, app).asAdmin()
+	noToken := http.Header{"X-Csrf-Token": {""}}
+
+	for _, tt := range tests {
+		if code, _ := c.do(http.MethodDelete, tt.path, nil, noToken); code != http.StatusBadRequest {
+			t.Errorf("DELETE %s without token: got status %d, want %d", tt.path, code, http.StatusBadRequest)
+		}
+		if err := tt.find(); err != nil {
+			t.Errorf("DELETE %s without token: the row should be kept: %v", tt.path, err)
+		}
+
+		if code, _ := c.do(http.MethodDelete, tt.path, nil, nil); code != http.StatusSeeOther {
+			t.Errorf("DELETE %s with token: got status %d, want %d", tt.path, code, http.StatusSeeOther)
+		}
+		if err := tt.find(); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("DELETE %s with token: got %v, want %v", tt.path, err, ErrNoRecord)
+		}
+	}
+}
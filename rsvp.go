@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lobre/bow"
+)
+
+// RSVP is a link letting a guest answer a single event without
+// being recognized, such as from an invitation sent by email.
+type RSVP struct {
+	Token   string
+	EventID int
+
+	GuestID int
+	Guest   *Guest
+}
+
+// RSVPService manages the links to answer a single event.
+type RSVPService struct {
+	db *bow.DB
+}
+
+// FindTokensByEvent returns the tokens of the links to an event, keyed by
+// the id of their guest. Guests who haven’t been given a link are missing.
+func (s *RSVPService) FindTokensByEvent(ctx context.Context, eventID int) (tokens map[int]string, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		tokens, err = findRSVPTokensByEvent(ctx, tx, eventID)
+		return err
+	})
+
+	return tokens, err
+}
+
+// FindRSVPByToken retrieves the link having the given token and attaches its guest.
+func (s *RSVPService) FindRSVPByToken(ctx context.Context, token string) (rsvp *RSVP, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `SELECT token, event_id, guest_id FROM rsvp_tokens WHERE token = ?`, token)
+
+		rsvp = &RSVP{}
+		if err := row.Scan(&rsvp.Token, &rsvp.EventID, &rsvp.GuestID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		rsvp.Guest, err = findGuestByID(ctx, tx, rsvp.GuestID)
+		return err
+	})
+
+	return rsvp, err
+}
+
+// RotateRSVP gives a guest a new link to an event.
+// The previous one, if any, stops working.
+func (s *RSVPService) RotateRSVP(ctx context.Context, eventID, guestID int) (*RSVP, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO rsvp_tokens (event_id, guest_id, token) VALUES (?, ?, ?)`,
+			eventID,
+			guestID,
+			token,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RSVP{Token: token, EventID: eventID, GuestID: guestID}, nil
+}
+
+func findRSVPTokensByEvent(ctx context.Context, tx *sql.Tx, eventID int) (map[int]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT guest_id, token FROM rsvp_tokens WHERE event_id = ?`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make(map[int]string)
+
+	for rows.Next() {
+		var guestID int
+		var token string
+
+		if err := rows.Scan(&guestID, &token); err != nil {
+			return nil, err
+		}
+
+		tokens[guestID] = token
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// fixtures describes the content of a seed file.
+// Events reference their status by label.
+type fixtures struct {
+	Statuses []struct {
+		Label       string `json:"label"`
+		Color       string `json:"color"`
+		Description string `json:"description"`
+		Icon        string `json:"icon"`
+	} `json:"statuses"`
+
+	Guests []struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"guests"`
+
+	Events []struct {
+		Title       string `json:"title"`
+		StartsAt    string `json:"starts_at"`
+		EndsAt      string `json:"ends_at"`
+		Description string `json:"description"`
+		Status      string `json:"status"`
+	} `json:"events"`
+}
+
+// seed loads statuses, guests and events from a json fixtures file
+// in a single transaction, once the services are built. Rows are created
+// with the same functions as the services. Statuses are identified by
+// their label, guests by their email and events by their title and start
+// date, so that rows already present are skipped and seeding twice
+// doesn’t duplicate data. On error, nothing is created.
+func (app *application) seed(ctx context.Context, r io.Reader) error {
+	var fix fixtures
+	if err := json.NewDecoder(r).Decode(&fix); err != nil {
+		return fmt.Errorf("cannot decode fixtures: %w", err)
+	}
+
+	statuses := make([]*Status, 0, len(fix.Statuses))
+	for _, s := range fix.Statuses {
+		if !colorRX.MatchString(s.Color) {
+			return fmt.Errorf("status %q: invalid color %q", s.Label, s.Color)
+		}
+
+		statuses = append(statuses, &Status{
+			Label:       s.Label,
+			Color:       s.Color,
+			Description: sql.NullString{String: s.Description, Valid: s.Description != ""},
+			Icon:        sql.NullString{String: s.Icon, Valid: s.Icon != ""},
+		})
+	}
+
+	guests := make([]*Guest, 0, len(fix.Guests))
+	for _, g := range fix.Guests {
+		guests = append(guests, &Guest{
+			Name:  g.Name,
+			Email: g.Email,
+		})
+	}
+
+	events := make([]*Event, 0, len(fix.Events))
+	for _, e := range fix.Events {
+		startsAt, err := time.Parse(layoutDatetime, e.StartsAt)
+		if err != nil {
+			return fmt.Errorf("event %q: %w", e.Title, err)
+		}
+
+		var endsAt sql.NullTime
+		if e.EndsAt != "" {
+			endsAt.Time, err = time.Parse(layoutDatetime, e.EndsAt)
+			if err != nil {
+				return fmt.Errorf("event %q: %w", e.Title, err)
+			}
+			endsAt.Valid = true
+		}
+
+		event := &Event{
+			Title:       e.Title,
+			StartsAt:    startsAt,
+			EndsAt:      endsAt,
+			Description: sql.NullString{String: e.Description, Valid: e.Description != ""},
+		}
+		app.eventService.configure(event)
+
+		events = append(events, event)
+	}
+
+	return withTx(ctx, app.DB, func(tx *sql.Tx) error {
+		statusIDs, err := seedStatuses(ctx, tx, statuses)
+		if err != nil {
+			return err
+		}
+
+		if err := seedGuests(ctx, tx, guests); err != nil {
+			return err
+		}
+
+		for i, event := range events {
+			if label := fix.Events[i].Status; label != "" {
+				id, ok := statusIDs[strings.ToLower(label)]
+				if !ok {
+					return fmt.Errorf("event %q: status %q: %w", event.Title, label, ErrNoRecord)
+				}
+				event.StatusID = sql.NullInt64{Int64: int64(id), Valid: true}
+			}
+
+			found, err := eventExists(ctx, tx, event.Title, event.StartsAt)
+			if err != nil {
+				return err
+			}
+			if found {
+				continue
+			}
+
+			if err := createEvent(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// seedStatuses creates the given statuses whose label is not known yet,
+// regardless of the case. It returns the ids of all the statuses
+// by lowercase label.
+func seedStatuses(ctx context.Context, tx *sql.Tx, statuses []*Status) (map[string]int, error) {
+	existing, _, err := findStatuses(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int, len(existing)+len(statuses))
+	for _, status := range existing {
+		ids[strings.ToLower(status.Label)] = status.ID
+	}
+
+	for _, status := range statuses {
+		if _, ok := ids[strings.ToLower(status.Label)]; ok {
+			continue
+		}
+
+		if err := createStatus(ctx, tx, status); err != nil {
+			return nil, err
+		}
+		ids[strings.ToLower(status.Label)] = status.ID
+	}
+
+	return ids, nil
+}
+
+// seedGuests creates the given guests whose email is not known yet.
+func seedGuests(ctx context.Context, tx *sql.Tx, guests []*Guest) error {
+	existing, _, err := findGuests(ctx, tx, GuestFilter{})
+	if err != nil {
+		return err
+	}
+
+	emails := make(map[string]bool, len(existing)+len(guests))
+	for _, guest := range existing {
+		emails[strings.ToLower(guest.Email)] = true
+	}
+
+	for _, guest := range guests {
+		if emails[strings.ToLower(guest.Email)] {
+			continue
+		}
+
+		if err := createGuest(ctx, tx, guest); err != nil {
+			return err
+		}
+		emails[strings.ToLower(guest.Email)] = true
+	}
+
+	return nil
+}
+
+// eventExists tells whether an event with the given title starts at the given time.
+func eventExists(ctx context.Context, tx *sql.Tx, title string, startsAt time.Time) (bool, error) {
+	events, _, err := findEvents(ctx, tx, EventFilter{Title: &title})
+	if err != nil {
+		return false, err
+	}
+
+	for _, event := range events {
+		if event.Title == title && event.StartsAt.Equal(startsAt) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
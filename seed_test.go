@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSeedTwice(t *testing.T) {
+	app := newTestApp(t, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		f, err := os.Open("seed.example.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = app.seed(ctx, f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("seeding #%d: %v", i+1, err)
+		}
+	}
+
+	if _, n, err := app.statusService.FindStatuses(ctx); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("got %d statuses, want 2", n)
+	}
+
+	if _, n, err := app.guestService.FindGuests(ctx, GuestFilter{}); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("got %d guests, want 2", n)
+	}
+
+	events, n, err := app.eventService.FindEvents(ctx, EventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d events, want 2", n)
+	}
+
+	for _, event := range events {
+		if event.Status == nil || event.Status.Label != "Confirmed" {
+			t.Errorf("event %q: got status %+v, want Confirmed", event.Title, event.Status)
+		}
+	}
+}
+
+func TestSeedInvalidFixtures(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixtures string
+		err      string
+	}{
+		{"color", `{"statuses": [{"label": "Confirmed", "color": "nope"}], "guests": [{"name": "Alice", "email": "alice@example.com"}]}`, "invalid color"},
+		{"date", `{"guests": [{"name": "Alice", "email": "alice@example.com"}], "events": [{"title": "Rehearsal", "starts_at": "tomorrow"}]}`, "Rehearsal"},
+		{"status", `{"statuses": [{"label": "Confirmed", "color": "#16a34a"}], "guests": [{"name": "Alice", "email": "alice@example.com"}], "events": [{"title": "Concert", "starts_at": "2030-01-09 20:00", "status": "Confirmed"}, {"title": "Rehearsal", "starts_at": "2030-01-10 19:00", "status": "Unknown"}]}`, "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, nil)
+			ctx := context.Background()
+
+			err := app.seed(ctx, strings.NewReader(tt.fixtures))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want one about %s", err, tt.err)
+			}
+
+			// the seed is rolled back as a whole
+			if _, n, err := app.statusService.FindStatuses(ctx); err != nil {
+				t.Fatal(err)
+			} else if n != 0 {
+				t.Errorf("got %d statuses, want none", n)
+			}
+			if _, n, err := app.guestService.FindGuests(ctx, GuestFilter{}); err != nil {
+				t.Fatal(err)
+			} else if n != 0 {
+				t.Errorf("got %d guests, want none", n)
+			}
+			if _, n, err := app.eventService.FindEvents(ctx, EventFilter{}); err != nil {
+				t.Fatal(err)
+			} else if n != 0 {
+				t.Errorf("got %d events, want none", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lobre/bow"
+)
+
+// defaultStatuses are proposed when setting up the application.
+// Their labels are translated and can be changed in the setup form.
+// Admins can also add them later from the list of statuses.
+var defaultStatuses = []*Status{
+	{Label: "Tentative", Color: "#f59e0b"},
+	{Label: "Confirmed", Color: "#16a34a"},
+	{Label: "Cancelled", Color: "#dc2626"},
+}
+
+// SetupService initializes the application on its first run.
+type SetupService struct {
+	db *bow.DB
+}
+
+// NeedsSetup reports whether the application has never been set up.
+func (s *SetupService) NeedsSetup(ctx context.Context) (needed bool, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		needed, err = needsSetup(ctx, tx)
+		return err
+	})
+
+	return needed, err
+}
+
+// Setup creates the first admin account, the statuses and the first guest
+// in a single transaction. It returns ErrSetupDone if the application
+// has already been set up.
+func (s *SetupService) Setup(ctx context.Context, admin *Admin, password string, statuses []*Status, guest *Guest) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		needed, err := needsSetup(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		if !needed {
+			return ErrSetupDone
+		}
+
+		if err := createAdmin(ctx, tx, admin, password); err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if err := createStatus(ctx, tx, status); err != nil {
+				return err
+			}
+		}
+
+		return createGuest(ctx, tx, guest)
+	})
+}
+
+// needsSetup considers the application as new when it has
+// no guests, no statuses and no admin accounts.
+func needsSetup(ctx context.Context, tx *sql.Tx) (bool, error) {
+	var n int
+
+	err := tx.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM guests) + (SELECT COUNT(*) FROM statuses) + (SELECT COUNT(*) FROM admins)`,
+	).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+
+	return n == 0, nil
+}
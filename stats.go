@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lobre/bow"
+)
+
+// heatmapLevels is the number of color shades of the heatmap,
+// the first one being used for buckets with no response.
+const heatmapLevels = 5
+
+// Heatmap counts the yes responses of past events by weekday and hour
+// of their start, with "if needed" ones when they are counted as yes.
+// All day events are left out, as they have no meaningful hour.
+type Heatmap struct {
+	Rows []*HeatmapRow
+	Max  int
+}
+
+// HeatmapRow holds the buckets of a weekday, by hour.
+type HeatmapRow struct {
+	// Day is a date falling on the weekday of the row.
+	// It is meant to be formatted to get the localized weekday name.
+	Day   time.Time
+	Cells []*HeatmapCell
+}
+
+type HeatmapCell struct {
+	Hour  int
+	N     int
+	Level int
+}
+
+type StatsService struct {
+	db *bow.DB
+
+	// These are needed to tell past events apart.
+	defaultDuration time.Duration
+	gracePeriod     time.Duration
+	location        *time.Location
+	now             func() time.Time
+
+	// ifNeeded tells whether "if needed" responses are counted as yes.
+	ifNeeded string
+}
+
+// AttendanceHeatmap returns the heatmap of yes responses of past events.
+// With no history, all the buckets of the heatmap are empty.
+func (s *StatsService) AttendanceHeatmap(ctx context.Context) (heatmap *Heatmap, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		heatmap, err = findAttendanceHeatmap(ctx, tx, s.defaultDuration, s.gracePeriod, wallClock(s.now, s.location), s.ifNeeded == IfNeededAsYes)
+		return err
+	})
+
+	return heatmap, err
+}
+
+func findAttendanceHeatmap(ctx context.Context, tx *sql.Tx, defaultDuration, gracePeriod time.Duration, now time.Time, ifNeededAsYes bool) (*Heatmap, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT
+			CAST(strftime('%w', starts_at) AS INTEGER),
+			CAST(strftime('%H', starts_at) AS INTEGER),
+			COUNT(*)
+		FROM participations
+		JOIN events ON events.id = participations.event_id
+		WHERE (attend = ? OR (attend = ? AND ?))
+		AND NOT all_day
+		AND datetime(`+effectiveEndsAtSQL+`, ?) <= datetime(?)
+		GROUP BY 1, 2`,
+		AttendYes,
+		AttendIfNeeded,
+		ifNeededAsYes,
+		sqlModifier(defaultDuration),
+		sqlModifier(gracePeriod),
+		now.Format(layoutSQLite),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// counts by weekday, sunday being 0 as in time.Weekday
+	var counts [7][24]int
+	var max int
+
+	for rows.Next() {
+		var weekday, hour, n int
+
+		err = rows.Scan(&weekday, &hour, &n)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[weekday][hour] = n
+		if n > max {
+			max = n
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	heatmap := Heatmap{Max: max}
+
+	// 2006-01-02 is a monday, so that weeks start on monday
+	monday := time.Date(2006, time.January, 2, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 7; i++ {
+		day := monday.AddDate(0, 0, i)
+		row := HeatmapRow{Day: day}
+
+		for hour, n := range counts[day.Weekday()] {
+			cell := HeatmapCell{Hour: hour, N: n}
+			if n > 0 {
+				// spread non empty buckets over the remaining levels,
+				// the busiest ones getting the darkest shade
+				cell.Level = heatmapLevels - 1 - (max-n)*(heatmapLevels-2)/max
+			}
+			row.Cells = append(row.Cells, &cell)
+		}
+
+		heatmap.Rows = append(heatmap.Rows, &row)
+	}
+
+	return &heatmap, nil
+}
@@ -4,74 +4,98 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"regexp"
 
 	"github.com/lobre/bow"
 	"github.com/mattn/go-sqlite3"
 )
 
+const (
+	maxStatusDescriptionLength = 200
+	maxStatusIconLength        = 8
+)
+
+// colorRX matches the colors accepted for statuses: the #RGB and #RRGGBB
+// hexadecimal notations and a few named colors. As the color ends up
+// in inline styles, anything else is rejected.
+var colorRX = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|black|blue|gray|green|orange|pink|purple|red|white|yellow)$`)
+
 type Status struct {
-	ID    int
-	Label string
-	Color string
+	ID          int
+	Label       string
+	Color       string
+	Description sql.NullString
+	Icon        sql.NullString
 }
 
 type StatusService struct {
 	db *bow.DB
-}
 
-func (s *StatusService) FindStatusByID(ctx context.Context, id int) (*Status, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+	// requireStatus keeps the last status from being removed,
+	// as events then can’t be created or updated without one.
+	requireStatus bool
+}
 
-	status, err := findStatusByID(ctx, tx, id)
-	if err != nil {
-		return nil, err
-	}
+func (s *StatusService) FindStatusByID(ctx context.Context, id int) (status *Status, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		status, err = findStatusByID(ctx, tx, id)
+		return err
+	})
 
-	return status, nil
+	return status, err
 }
 
-func (s *StatusService) FindStatuses(ctx context.Context) ([]*Status, int, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer tx.Rollback()
+func (s *StatusService) FindStatuses(ctx context.Context) (statuses []*Status, n int, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		statuses, n, err = findStatuses(ctx, tx)
+		return err
+	})
 
-	return findStatuses(ctx, tx)
+	return statuses, n, err
 }
 
 func (s *StatusService) CreateStatus(ctx context.Context, status *Status) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return createStatus(ctx, tx, status)
+	})
+}
 
-	err = createStatus(ctx, tx, status)
-	if err != nil {
-		return err
-	}
+// SeedStatuses creates the given statuses, skipping the ones whose label
+// already exists regardless of the case. It can be run several times
+// and returns how many statuses have been created and skipped.
+func (s *StatusService) SeedStatuses(ctx context.Context, statuses []*Status) (created, skipped int, err error) {
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		for _, status := range statuses {
+			var n int
+			err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM statuses WHERE label = ? COLLATE NOCASE`, status.Label).Scan(&n)
+			if err != nil {
+				return err
+			}
 
-	return tx.Commit()
-}
+			if n > 0 {
+				skipped++
+				continue
+			}
 
-func (s *StatusService) DeleteStatus(ctx context.Context, id int) error {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+			if err := createStatus(ctx, tx, status); err != nil {
+				return err
+			}
+			created++
+		}
 
-	err = deleteStatus(ctx, tx, id)
+		return nil
+	})
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	return tx.Commit()
+	return created, skipped, nil
+}
+
+func (s *StatusService) DeleteStatus(ctx context.Context, id int) error {
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		return deleteStatus(ctx, tx, id, s.requireStatus)
+	})
 }
 
 func findStatuses(ctx context.Context, tx *sql.Tx) (_ []*Status, n int, err error) {
@@ -80,6 +104,8 @@ func findStatuses(ctx context.Context, tx *sql.Tx) (_ []*Status, n int, err erro
 			id,
 			label,
 			color,
+			description,
+			icon,
 			COUNT(*) OVER()
 		FROM statuses
 		ORDER BY label`,
@@ -94,7 +120,7 @@ func findStatuses(ctx context.Context, tx *sql.Tx) (_ []*Status, n int, err erro
 	for rows.Next() {
 		var s Status
 
-		err = rows.Scan(&s.ID, &s.Label, &s.Color, &n)
+		err = rows.Scan(&s.ID, &s.Label, &s.Color, &s.Description, &s.Icon, &n)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, 0, ErrNoRecord
@@ -113,10 +139,10 @@ func findStatuses(ctx context.Context, tx *sql.Tx) (_ []*Status, n int, err erro
 }
 
 func findStatusByID(ctx context.Context, tx *sql.Tx, id int) (*Status, error) {
-	row := tx.QueryRowContext(ctx, `SELECT id, label, color FROM statuses WHERE id = ?`, id)
+	row := tx.QueryRowContext(ctx, `SELECT id, label, color, description, icon FROM statuses WHERE id = ?`, id)
 
 	var status Status
-	err := row.Scan(&status.ID, &status.Label, &status.Color)
+	err := row.Scan(&status.ID, &status.Label, &status.Color, &status.Description, &status.Icon)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -129,9 +155,11 @@ func findStatusByID(ctx context.Context, tx *sql.Tx, id int) (*Status, error) {
 
 func createStatus(ctx context.Context, tx *sql.Tx, status *Status) error {
 	res, err := tx.ExecContext(ctx,
-		`INSERT INTO statuses (label, color) VALUES (?, ?)`,
+		`INSERT INTO statuses (label, color, description, icon) VALUES (?, ?, ?, ?)`,
 		status.Label,
 		status.Color,
+		status.Description,
+		status.Icon,
 	)
 	if err != nil {
 		return err
@@ -146,7 +174,18 @@ func createStatus(ctx context.Context, tx *sql.Tx, status *Status) error {
 	return nil
 }
 
-func deleteStatus(ctx context.Context, tx *sql.Tx, id int) error {
+// deleteStatus removes a status. When keepLast is set, the last
+// one is kept, and ErrLastStatus is returned instead.
+func deleteStatus(ctx context.Context, tx *sql.Tx, id int, keepLast bool) error {
+	if keepLast {
+		var n int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM statuses WHERE id != ?`, id).Scan(&n); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrLastStatus
+		}
+	}
+
 	_, err := tx.ExecContext(ctx, `DELETE FROM statuses WHERE id = ?`, id)
 	if err != nil {
 		var sqliteError sqlite3.Error
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeleteLastStatus(t *testing.T) {
+	app := newTestApp(t, nil)
+	first := mustCreateStatus(t, app, "Confirmed")
+	last := mustCreateStatus(t, app, "Cancelled")
+
+	ctx := context.Background()
+
+	if err := app.statusService.DeleteStatus(ctx, first.ID); err != nil {
+		t.Fatalf("deleting a status among others: %v", err)
+	}
+
+	if err := app.statusService.DeleteStatus(ctx, last.ID); !errors.Is(err, ErrLastStatus) {
+		t.Fatalf("deleting the last status: got %v, want %v", err, ErrLastStatus)
+	}
+
+	c := newTestClient(t, app).asAdmin()
+	if code, _ := c.do(http.MethodDelete, fmt.Sprintf("/status/%d", last.ID), nil, nil); code != http.StatusSeeOther {
+		t.Errorf("deleting the last status from the page: got status %d, want %d", code, http.StatusSeeOther)
+	}
+	if _, body := c.do(http.MethodGet, "/status", nil, nil); !strings.Contains(body, "Can’t delete the last status") {
+		t.Errorf("the reason why the last status was kept is not shown")
+	}
+
+	if _, n, err := app.statusService.FindStatuses(ctx); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("got %d statuses, want the last one kept", n)
+	}
+}
+
+func TestDeleteLastStatusNotRequired(t *testing.T) {
+	app := newTestApp(t, func(cfg *config) { cfg.requireStatus = false })
+	status := mustCreateStatus(t, app, "Confirmed")
+
+	if err := app.statusService.DeleteStatus(context.Background(), status.ID); err != nil {
+		t.Fatalf("deleting the last status when not required: %v", err)
+	}
+}
@@ -1,16 +1,38 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
 	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/benbjohnson/hashfs"
 	"github.com/lobre/bow"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type contextKey int
 
-const contextKeyCurrentGuest contextKey = iota
+const (
+	contextKeyCurrentGuest contextKey = iota
+	contextKeyCurrentAdmin
+	contextKeyPendingCount
+	contextKeyProxied
+)
 
 type templateData struct {
 	Form *bow.Form
@@ -20,26 +42,468 @@ type templateData struct {
 	Guest    *Guest
 	Guests   []*Guest
 	Statuses []*Status
+	Admins   []*Admin
+
+	Counts  *EventCounts
+	Heatmap *Heatmap
+
+	// NextPage is the page of events following the displayed one,
+	// or 0 if there is none.
+	NextPage int
 
 	CurrentParticipation *Participation
 
-	AttendText map[int64]string
+	// Participations are the ones affected by an action.
+	Participations []*Participation
+
+	// RSVPTokens are the tokens of the links to answer
+	// an event, keyed by the id of their guest.
+	RSVPTokens map[int]string
+
+	// AttendFilter is the response guests are filtered on.
+	AttendFilter string
 }
 
 // addGlobals automatically injects data that are common to all pages.
 func (app *application) addGlobals(r *http.Request) interface{} {
 	return struct {
 		CurrentGuest *Guest
+		CurrentAdmin *Admin
 		IsAdmin      bool
+		AppName      string
 		AsDate       string
 		AsTime       string
 		Logo         string
+		Favicon      string
+		TouchIcon    string
+		ThemeColor   string
+		Theme        string
+
+		// Impersonating is true when an admin
+		// is seeing the app as another guest.
+		Impersonating bool
+
+		// StatusRequired is false when events can have no status.
+		StatusRequired bool
+
+		MaxTitleLength int
+
+		// MinNotice is true when new events
+		// can’t start right away.
+		MinNotice bool
+
+		// Columns are the optional columns
+		// displayed in the list of events.
+		Columns map[string]bool
+
+		// Pending is the number of events awaiting
+		// a response from the current guest.
+		Pending int
+
+		// PendingLabel is shown for guests who
+		// haven’t answered, before being translated.
+		PendingLabel string
+
+		// RefreshInterval is how often the guests of an event are
+		// reloaded on its page, in milliseconds, or 0 for never.
+		RefreshInterval int64
 	}{
 		currentGuest(r),
+		currentAdmin(r),
 		app.isAdmin(r),
+		app.config.appName,
 		"Monday 2 January 2006",
 		"15:04",
 		app.config.logo,
+		path.Join("assets", app.config.favicon),
+		path.Join("assets", app.config.touchIcon),
+		app.config.themeColor,
+		currentTheme(r),
+		app.Session.Exists(r, "impersonator"),
+		app.config.requireStatus,
+		app.config.maxTitleLength,
+		app.config.minNotice > 0,
+		app.config.listColumns,
+		pendingCount(r),
+		app.config.pendingLabel,
+		app.config.refreshInterval.Milliseconds(),
+	}
+}
+
+// currentTheme returns the color theme preferred by the current guest.
+// It falls back to the auto theme when no guest is recognized.
+func currentTheme(r *http.Request) string {
+	if guest := currentGuest(r); guest != nil {
+		return guest.Theme
+	}
+	return "auto"
+}
+
+// baseURL returns the scheme and host the request has been sent to.
+// It can be used to generate absolute links. The X-Forwarded-Proto
+// header is only read when the request comes from a trusted proxy,
+// as told by realIP, as anyone could set it.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || isProxied(r) && r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// slugify turns a text into a lowercase string made of letters,
+// digits and dashes that can safely be used in filenames.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// csvCell prefixes a value with a quote when it starts with a character
+// that spreadsheets would take for a formula, so that names and emails
+// entered by guests can’t run anything when an export is opened.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// relativeTime describes t relatively to now, such as "in 3 days" or
+// "yesterday". It returns an empty string when t is more than a week
+// away, as an absolute date is then easier to read. The returned
+// messages are meant to be passed to the translate template function.
+func (app *application) relativeTime(t time.Time) string {
+	return formatRelative(t, app.now())
+}
+
+// now returns the current time in the time zone of the application,
+// to be compared with the dates of events. See wallClock.
+func (app *application) now() time.Time {
+	return wallClock(app.clock, app.config.location)
+}
+
+func formatRelative(t, now time.Time) string {
+	d := t.Sub(now)
+
+	past := d < 0
+	if past {
+		d = -d
+	}
+
+	var n int
+	var unit string
+
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int(d/time.Hour), "hour"
+	case d < 7*24*time.Hour:
+		// count days on the calendar rather than periods of 24 hours
+		y1, m1, d1 := now.Date()
+		y2, m2, d2 := t.Date()
+		days := time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).Sub(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC))
+		if days < 0 {
+			days = -days
+		}
+		n, unit = int(days/(24*time.Hour)), "day"
+	default:
+		return ""
+	}
+
+	if unit == "day" && n == 1 {
+		if past {
+			return "yesterday"
+		}
+		return "tomorrow"
+	}
+
+	if n > 1 {
+		unit += "s"
+	}
+
+	if past {
+		return fmt.Sprintf("%d %s ago", n, unit)
+	}
+	return fmt.Sprintf("in %d %s", n, unit)
+}
+
+// withReqFuncs is like bow.WithReqFuncs, but also declares the functions
+// before the views are parsed, which bow.WithReqFuncs doesn’t, so that
+// templates using them can be parsed.
+func withReqFuncs(funcs bow.ReqFuncMap) bow.Option {
+	return func(core *bow.Core) error {
+		core.Views.ReqFuncs(funcs)
+		return nil
+	}
+}
+
+// attendLabel returns the template function giving the label of an
+// answer, translated in the language of the request. Guests who
+// haven’t answered are labelled as such.
+func (app *application) attendLabel(r *http.Request) interface{} {
+	return func(attend sql.NullInt64) string {
+		return app.translateAttend(attend, app.reqLocale(r))
+	}
+}
+
+// translateAttend returns the label of an answer translated in the given locale.
+func (app *application) translateAttend(attend sql.NullInt64, locale string) string {
+	label := NoAnswerText
+	if attend.Valid {
+		label = AttendText[attend.Int64]
+	}
+	return app.translator.Translate(label, locale)
+}
+
+// highlight wraps the case insensitive matches of query in text with mark
+// elements. The rest of the text is escaped, so that the result can safely
+// be displayed. The text is returned unchanged for a blank query.
+func highlight(text, query string) template.HTML {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	n := utf8.RuneCountInString(query)
+
+	var b strings.Builder
+	last := 0
+
+	for i := 0; i < len(text); {
+		// end of the candidate having as many runes as the query
+		j := i
+		for k := 0; k < n && j < len(text); k++ {
+			_, size := utf8.DecodeRuneInString(text[j:])
+			j += size
+		}
+
+		if strings.EqualFold(text[i:j], query) {
+			b.WriteString(template.HTMLEscapeString(text[last:i]))
+			b.WriteString("<mark>")
+			b.WriteString(template.HTMLEscapeString(text[i:j]))
+			b.WriteString("</mark>")
+			i, last = j, j
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
+}
+
+// renderStream renders a turbo stream like Views.RenderStream. When a flash
+// message is pending, it is first sent as a stream updating the #flash
+// element, as streams don’t reload the layout that would otherwise show it.
+//
+// Both streams are buffered, so that an error in any of them
+// results in a clean server error with nothing else sent.
+func (app *application) renderStream(action bow.StreamAction, target string, w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	stream := &bufferedWriter{ResponseWriter: w}
+	app.Views.RenderStream(action, target, stream, r, name, data)
+	if stream.status != http.StatusOK {
+		stream.flush()
+		return
+	}
+
+	if app.Session.Exists(r, "flash") {
+		flash := &bufferedWriter{ResponseWriter: w}
+		app.Views.RenderStream(bow.ActionUpdate, "flash", flash, r, "layouts/flash", nil)
+		if flash.status != http.StatusOK {
+			flash.flush()
+			return
+		}
+
+		stream.buf.WriteTo(&flash.buf)
+		stream = flash
+	}
+
+	stream.flush()
+}
+
+// bufferedWriter holds the status and the body written by a handler
+// until flush is called, so that they can be discarded on error.
+// Headers are set directly on the wrapped writer.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.buf.Write(b)
+}
+
+// flush sends the status and the body to the wrapped writer. A successful
+// status is left implicit, as several streams can be sent in a response.
+func (w *bufferedWriter) flush() {
+	if w.status != 0 && w.status != http.StatusOK {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.buf.WriteTo(w.ResponseWriter)
+}
+
+// inputDateLayouts and inputTimeLayouts are the formats accepted per locale
+// in date and time inputs, for browsers that show them as plain text fields.
+// The canonical layouts are always accepted.
+var (
+	inputDateLayouts = map[string][]string{
+		"en_US": {"01/02/2006", "1/2/2006", "Jan 2, 2006", "January 2, 2006"},
+		"fr_FR": {"02/01/2006", "2/1/2006", "02.01.2006", "2.1.2006"},
+	}
+
+	inputTimeLayouts = map[string][]string{
+		"en_US": {"3:04 PM", "3:04PM", "3:04 pm", "3:04pm", "3 PM", "3PM"},
+		"fr_FR": {"15h04", "15h"},
+	}
+)
+
+// reqLocale returns the locale used to display the request.
+func (app *application) reqLocale(r *http.Request) string {
+	if app.config.locale != "auto" {
+		return app.config.locale
+	}
+	return app.translator.ReqLocale(r)
+}
+
+// normalizeDatetimes rewrites the given date and time fields of a form in the
+// canonical layouts when they are written in a format of the request locale.
+// Values that can’t be parsed are left as is for the validation to catch them.
+func (app *application) normalizeDatetimes(r *http.Request, form *bow.Form, dateFields, timeFields []string) {
+	locale := app.reqLocale(r)
+
+	normalize := func(fields []string, canonical string, layouts []string) {
+		for _, field := range fields {
+			value := strings.TrimSpace(form.Get(field))
+			if value == "" {
+				continue
+			}
+
+			for _, layout := range append([]string{canonical}, layouts...) {
+				if t, err := time.Parse(layout, value); err == nil {
+					form.Set(field, t.Format(canonical))
+					break
+				}
+			}
+		}
+	}
+
+	normalize(dateFields, layoutDate, inputDateLayouts[locale])
+	normalize(timeFields, layoutTime, inputTimeLayouts[locale])
+}
+
+// requiredIf records the given error on a field left blank
+// while the other field is filled.
+func requiredIf(form *bow.Form, field, other, msg string) {
+	if strings.TrimSpace(form.Get(other)) != "" && strings.TrimSpace(form.Get(field)) == "" {
+		form.CustomError(field, msg)
+	}
+}
+
+// exclusive records the given error on a field filled
+// while one of the other fields is filled too.
+func exclusive(form *bow.Form, field string, others []string, msg string) {
+	if strings.TrimSpace(form.Get(field)) == "" {
+		return
+	}
+
+	for _, other := range others {
+		if strings.TrimSpace(form.Get(other)) != "" {
+			form.CustomError(field, msg)
+			return
+		}
+	}
+}
+
+// isDuration records an error on the given fields when they are filled
+// with something else than a positive duration such as 1h30m.
+func isDuration(form *bow.Form, fields ...string) {
+	for _, field := range fields {
+		value := form.Get(field)
+		if value == "" {
+			continue
+		}
+
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			form.CustomError(field, "This field is not a valid duration")
+		}
+	}
+}
+
+// phoneRX matches phone numbers in a loose international format: an optional
+// leading plus followed by digits, which can be grouped with spaces, dots,
+// dashes or parentheses. The number of digits is checked by isPhone.
+var phoneRX = regexp.MustCompile(`^\+?[0-9(][0-9 .()-]{4,}[0-9]$`)
+
+// isURL records an error on the given fields when they are filled
+// with something else than an absolute url with a scheme and a host.
+func isURL(form *bow.Form, fields ...string) {
+	for _, field := range fields {
+		value := form.Get(field)
+		if value == "" {
+			continue
+		}
+
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			form.CustomError(field, "This field is not a valid url")
+		}
+	}
+}
+
+// isPhone records an error on the given fields when they are filled
+// with something else than a phone number matching pattern. A nil pattern
+// defaults to phoneRX, with which the number of digits is also checked.
+func isPhone(form *bow.Form, pattern *regexp.Regexp, fields ...string) {
+	checkDigits := pattern == nil
+	if pattern == nil {
+		pattern = phoneRX
+	}
+
+	for _, field := range fields {
+		value := form.Get(field)
+		if value == "" {
+			continue
+		}
+
+		valid := pattern.MatchString(value)
+
+		if valid && checkDigits {
+			digits := strings.Map(func(r rune) rune {
+				if unicode.IsDigit(r) {
+					return r
+				}
+				return -1
+			}, value)
+			valid = len(digits) >= 6 && len(digits) <= 15
+		}
+
+		if !valid {
+			form.CustomError(field, "This field is not a valid phone number")
+		}
 	}
 }
 
@@ -53,7 +517,7 @@ func (app *application) recognizeGuest(next http.Handler) http.Handler {
 			return
 		}
 
-		guest, err := app.guestService.FindGuestByID(r.Context(), app.Session.GetInt(r, "guest"))
+		guest, err := app.guestService.FindGuestByID(r.Context(), app.Session.GetInt(r, "guest"), GuestHistory{})
 		if errors.Is(err, ErrNoRecord) {
 			app.Session.Remove(r, "guest")
 		} else if err != nil {
@@ -62,6 +526,61 @@ func (app *application) recognizeGuest(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), contextKeyCurrentGuest, guest)
+
+		// pages show how many events await a response, so it is
+		// counted once here rather than each time globals are read
+		if guest != nil && r.Method == http.MethodGet {
+			n, err := app.eventService.CountPending(r.Context(), guest.ID)
+			if err != nil {
+				app.Views.ServerError(w, err)
+				return
+			}
+			ctx = context.WithValue(ctx, contextKeyPendingCount, n)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// recognizeAdmin is a middleware that checks the admin account stored in the
+// session when in admin mode. The admin mode is left if the account has been
+// disabled or removed. Otherwise, the account is added to the request context.
+func (app *application) recognizeAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAdmin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var admin *Admin
+		var err error
+
+		if id := app.Session.GetInt(r, "admin"); id != 0 {
+			admin, err = app.adminService.FindAdminByID(r.Context(), id)
+			if err == nil && admin.Disabled {
+				err = ErrNoRecord
+			}
+		} else {
+			// an admin mode without account is only
+			// allowed as long as no account exists
+			var has bool
+			has, err = app.adminService.HasAdmins(r.Context())
+			if err == nil && has {
+				err = ErrNoRecord
+			}
+		}
+
+		if errors.Is(err, ErrNoRecord) {
+			app.Session.Remove(r, "isAdmin")
+			app.Session.Remove(r, "admin")
+			next.ServeHTTP(w, r)
+			return
+		} else if err != nil {
+			app.Views.ServerError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyCurrentAdmin, admin)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -90,12 +609,41 @@ func currentGuest(r *http.Request) *Guest {
 	return guest
 }
 
+// pendingCount returns the number of events awaiting
+// a response from the current guest.
+func pendingCount(r *http.Request) int {
+	n, _ := r.Context().Value(contextKeyPendingCount).(int)
+	return n
+}
+
+// currentAdmin returns the admin account of the current user.
+// It returns nil when not in admin mode, or when no account exists yet.
+func currentAdmin(r *http.Request) *Admin {
+	admin, ok := r.Context().Value(contextKeyCurrentAdmin).(*Admin)
+	if !ok {
+		return nil
+	}
+	return admin
+}
+
 // isAdmin returns true if the current user is connected
 // as admin, otherwise false.
 func (app *application) isAdmin(r *http.Request) bool {
 	return app.Session.GetBool(r, "isAdmin")
 }
 
+// actorName returns the name of who makes the request, to be recorded
+// in histories. Admin accounts take precedence over guests.
+func (app *application) actorName(r *http.Request) string {
+	if admin := currentAdmin(r); admin != nil {
+		return admin.Username
+	}
+	if guest := currentGuest(r); guest != nil {
+		return guest.Name
+	}
+	return ""
+}
+
 // requireAdmin is a middleware that redirects the user to the homepage
 // page if he is not admin.
 func (app *application) requireAdmin(next http.Handler) http.Handler {
@@ -105,7 +653,309 @@ func (app *application) requireAdmin(next http.Handler) http.Handler {
 			return
 		}
 
+		// keep track of who changes what
+		if admin := currentAdmin(r); admin != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			app.Logger.Printf("admin %s: %s %s", admin.Username, r.Method, r.URL.Path)
+		}
+
 		w.Header().Add("Cache-Control", "no-store")
 		next.ServeHTTP(w, r)
 	})
 }
+
+// parseTrustedProxies parses a comma separated list of IP addresses and CIDR ranges.
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", part)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipnet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", part)
+		}
+		nets = append(nets, ipnet)
+	}
+
+	return nets, nil
+}
+
+// isTrustedProxy reports whether the given address is one of the trusted proxies.
+func (app *application) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipnet := range app.config.trustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP address of the client. When the request comes
+// from a trusted proxy, it is read from the X-Forwarded-For header,
+// skipping the proxies, or from the X-Real-IP header. Otherwise these
+// headers are ignored, as anyone could set them.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if !app.isTrustedProxy(ip) {
+		return ip
+	}
+
+	// each proxy appends the address it received the request
+	// from, so the client is the last untrusted one
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		addrs := strings.Split(fwd, ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if net.ParseIP(addr) == nil {
+				break
+			}
+
+			ip = addr
+			if !app.isTrustedProxy(addr) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if addr := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(addr) != nil {
+		return addr
+	}
+
+	return ip
+}
+
+// realIP is a middleware that replaces the remote address of requests
+// with the IP of the client, so that the logs of the core show it
+// even behind a reverse proxy. Requests coming from a trusted proxy
+// are marked as such, as the original address is then lost.
+func (app *application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(app.config.trustedProxies) > 0 {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+
+			if app.isTrustedProxy(ip) {
+				r = r.WithContext(context.WithValue(r.Context(), contextKeyProxied, true))
+			}
+
+			r.RemoteAddr = app.clientIP(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isProxied reports whether the request has been
+// forwarded by one of the trusted proxies.
+func isProxied(r *http.Request) bool {
+	proxied, _ := r.Context().Value(contextKeyProxied).(bool)
+	return proxied
+}
+
+// parseBasicAuth parses the user and the bcrypt hash of the password
+// of the -basic-auth flag, separated by a colon.
+func parseBasicAuth(s string) (user string, hash []byte, err error) {
+	i := strings.Index(s, ":")
+	if i < 1 {
+		return "", nil, errors.New("expected user:hash")
+	}
+
+	user, hash = s[:i], []byte(s[i+1:])
+	if _, err := bcrypt.Cost(hash); err != nil {
+		return "", nil, fmt.Errorf("invalid bcrypt hash: %w", err)
+	}
+
+	return user, hash, nil
+}
+
+// basicAuth is a middleware that asks for the credentials of -basic-auth
+// before letting requests through, so that a private instance can be
+// protected without accounts. It is meant to be mounted after the
+// standard chain, so that rejections are logged and panics recovered.
+// Wrong credentials are logged as well.
+//
+// The password is checked against the bcrypt hash given in -basic-auth,
+// which is deliberately slow. As browsers send the credentials with every
+// request, the sha256 digest of the last ones that matched is kept in
+// basicAuthDigest, an atomic.Value as requests run concurrently, and
+// requests sending them again are compared to it in constant time instead.
+// Other credentials go through bcrypt and replace the digest if they match.
+// The digest only lives in memory and is lost on restart.
+func (app *application) basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if ok {
+			digest := sha256.Sum256([]byte(user + ":" + password))
+			known, _ := app.basicAuthDigest.Load().([]byte)
+
+			if known != nil && subtle.ConstantTimeCompare(digest[:], known) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userMatch := subtle.ConstantTimeCompare([]byte(user), []byte(app.config.basicAuthUser)) == 1
+			passwordMatch := bcrypt.CompareHashAndPassword(app.config.basicAuthHash, []byte(password)) == nil
+
+			if userMatch && passwordMatch {
+				app.basicAuthDigest.Store(digest[:])
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			app.Logger.Printf("wrong basic auth credentials for user %q from %s", user, r.RemoteAddr)
+		}
+
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, app.config.appName))
+		app.Views.ClientError(w, http.StatusUnauthorized)
+	})
+}
+
+// cookiePrefixRX matches the prefixes allowed in the names of cookies.
+var cookiePrefixRX = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+// prefixCookies is a middleware that adds a prefix to the names of the cookies
+// sent to clients, and that only passes on the received cookies having it,
+// without the prefix. This way, the session, CSRF and language cookies
+// of several instances running on the same domain don’t clobber each other,
+// while the handlers still see their usual names.
+func prefixCookies(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var cookies []string
+			for _, cookie := range r.Cookies() {
+				if strings.HasPrefix(cookie.Name, prefix) {
+					cookies = append(cookies, strings.TrimPrefix(cookie.Name, prefix)+"="+cookie.Value)
+				}
+			}
+
+			r.Header.Del("Cookie")
+			if len(cookies) > 0 {
+				r.Header.Set("Cookie", strings.Join(cookies, "; "))
+			}
+
+			next.ServeHTTP(&cookiePrefixWriter{ResponseWriter: w, prefix: prefix}, r)
+		})
+	}
+}
+
+// cookiePrefixWriter prefixes the names of the cookies
+// set by the wrapped handler right before they are sent.
+type cookiePrefixWriter struct {
+	http.ResponseWriter
+	prefix      string
+	wroteHeader bool
+}
+
+func (w *cookiePrefixWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.Header()
+		for i, cookie := range header["Set-Cookie"] {
+			header["Set-Cookie"][i] = w.prefix + cookie
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cookiePrefixWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// limitBody is a middleware that limits the size of request bodies
+// to the given number of bytes.
+func limitBody(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// cacheAssets is a middleware that sets the cache policy of static assets.
+// Hashed filenames change with their content, so they can be cached forever.
+// Others have to be revalidated by the browser on each use.
+func cacheAssets(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := "no-cache"
+		if _, hash := hashfs.ParseName(r.URL.Path); hash != "" {
+			policy = "public, max-age=31536000, immutable"
+		}
+
+		next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, policy: policy}, r)
+	})
+}
+
+// serveIcon serves an icon of the assets at the fixed URL where browsers
+// look for it when pages don’t link to it, such as /favicon.ico. As the URL
+// doesn’t change with the content, it is only cached for a day.
+func (app *application) serveIcon(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := fs.ReadFile(app.assets, path.Join("assets", name))
+		if err != nil {
+			app.Views.ServerError(w, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+	})
+}
+
+// cacheControlWriter overrides the Cache-Control header
+// set by the wrapped handler right before it is sent.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code < 400 {
+			w.Header().Set("Cache-Control", w.policy)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
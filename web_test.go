@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/lobre/bow"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBaseURLForwardedProto(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		proxies    bool
+		remoteAddr string
+		want       string
+	}{
+		{"trusted proxy", true, "10.0.0.1:4321", "https://tdispo.example.com"},
+		{"untrusted peer", true, "203.0.113.5:4321", "http://tdispo.example.com"},
+		{"no trusted proxies", false, "10.0.0.1:4321", "http://tdispo.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{}
+			if tt.proxies {
+				app.config.trustedProxies = proxies
+			}
+
+			var got string
+			h := app.realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = baseURL(r)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "http://tdispo.example.com/feed.atom", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("X-Forwarded-Proto", "https")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheAssets(t *testing.T) {
+	app := newTestApp(t, nil)
+	h := app.routes()
+
+	tests := []struct {
+		path   string
+		policy string
+	}{
+		{"/" + app.assets.HashName("assets/logo.svg"), "public, max-age=31536000, immutable"},
+		{"/assets/logo.svg", "no-cache"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d", tt.path, w.Code)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.policy {
+			t.Errorf("%s: got Cache-Control %q, want %q", tt.path, got, tt.policy)
+		}
+	}
+}
+
+func TestNormalizeDatetimes(t *testing.T) {
+	tests := []struct {
+		locale string
+		date   string
+		time   string
+
+		wantDate string
+		wantTime string
+	}{
+		{"fr_FR", "31/12/2024", "20h30", "2024-12-31", "20:30"},
+		{"fr_FR", "01/02/2024", "9h", "2024-02-01", "09:00"},
+		{"en_US", "12/31/2024", "8:30 PM", "2024-12-31", "20:30"},
+		{"en_US", "01/02/2024", "9AM", "2024-01-02", "09:00"},
+		{"en_US", "2024-12-31", "20:30", "2024-12-31", "20:30"},
+
+		// formats of other locales are left for the validation to reject
+		{"en_US", "31/12/2024", "20h30", "31/12/2024", "20h30"},
+	}
+
+	for _, tt := range tests {
+		app := &application{config: config{locale: tt.locale}}
+
+		form := bow.NewForm(url.Values{"startdate": {tt.date}, "starttime": {tt.time}})
+		app.normalizeDatetimes(httptest.NewRequest(http.MethodPost, "/new", nil), form, []string{"startdate"}, []string{"starttime"})
+
+		if got := form.Get("startdate"); got != tt.wantDate {
+			t.Errorf("%s %q: got date %q, want %q", tt.locale, tt.date, got, tt.wantDate)
+		}
+		if got := form.Get("starttime"); got != tt.wantTime {
+			t.Errorf("%s %q: got time %q, want %q", tt.locale, tt.time, got, tt.wantTime)
+		}
+	}
+}
+
+func TestRequiredIf(t *testing.T) {
+	tests := []struct {
+		enddate string
+		endtime string
+		invalid bool
+	}{
+		{"", "", false},
+		{"2030-06-01", "", true},
+		{"", "20:00", false},
+		{"2030-06-01", "20:00", false},
+	}
+
+	for _, tt := range tests {
+		form := bow.NewForm(url.Values{"enddate": {tt.enddate}, "endtime": {tt.endtime}})
+		requiredIf(form, "endtime", "enddate", "This field cannot be blank as end date is filled")
+
+		if invalid := form.Error("endtime") != ""; invalid != tt.invalid {
+			t.Errorf("end date %q and end time %q: got error %t, want %t", tt.enddate, tt.endtime, invalid, tt.invalid)
+		}
+		if form.Error("enddate") != "" {
+			t.Errorf("end date %q and end time %q: got an error on the other field", tt.enddate, tt.endtime)
+		}
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"", true},
+		{"https://example.com", true},
+		{"http://example.com/events?id=1", true},
+		{"example.com", false},
+		{"/events/1", false},
+		{"https://", false},
+		{"http://exa mple.com", false},
+	}
+
+	for _, tt := range tests {
+		form := bow.NewForm(url.Values{"link": {tt.value}})
+		isURL(form, "link")
+
+		if valid := form.Valid(); valid != tt.valid {
+			t.Errorf("%q: got valid %t, want %t", tt.value, valid, tt.valid)
+		}
+	}
+}
+
+func TestIsPhone(t *testing.T) {
+	tests := []struct {
+		value   string
+		pattern *regexp.Regexp
+		valid   bool
+	}{
+		{"", nil, true},
+		{"+33612345678", nil, true},
+		{"+1 (555) 123-4567", nil, true},
+		{"06.12.34.56.78", nil, true},
+		{"12345", nil, false},
+		{"+1234567890123456", nil, false},
+		{"call me", nil, false},
+		{"+33 6 12 34 56 78 ext", nil, false},
+
+		// custom patterns are used as is
+		{"0612345678", regexp.MustCompile(`^0[1-9][0-9]{8}$`), true},
+		{"+33612345678", regexp.MustCompile(`^0[1-9][0-9]{8}$`), false},
+	}
+
+	for _, tt := range tests {
+		form := bow.NewForm(url.Values{"phone": {tt.value}})
+		isPhone(form, tt.pattern, "phone")
+
+		if valid := form.Valid(); valid != tt.valid {
+			t.Errorf("%q: got valid %t, want %t", tt.value, valid, tt.valid)
+		}
+	}
+}
+
+// streamItem is rendered by the templates of TestRenderStreamError,
+// which fail while executing when Fail returns an error.
+type streamItem struct {
+	Name string
+	err  error
+}
+
+func (item streamItem) Fail() (string, error) {
+	return "", item.err
+}
+
+func TestRenderStreamError(t *testing.T) {
+	const (
+		item      = `{{ define "events/item" }}<p>{{ .Name }}</p>{{ .Fail }}{{ end }}`
+		flash     = `{{ define "layouts/flash" }}<p>Saved</p>{{ end }}`
+		flashFail = `{{ define "layouts/flash" }}<p>Saved</p>{{ index . 1 }}{{ end }}`
+	)
+
+	tests := []struct {
+		name      string
+		flash     string
+		withFlash bool
+		err       error
+		code      int
+		want      []string
+		notWant   []string
+	}{
+		{"stream", flash, false, nil, http.StatusOK, []string{`target="item"`, "<p>Rehearsal</p>"}, nil},
+		{"stream and flash", flash, true, nil, http.StatusOK, []string{`target="flash"`, "<p>Saved</p>", "<p>Rehearsal</p>"}, nil},
+		{"failing stream", flash, false, errors.New("boom"), http.StatusInternalServerError, nil, []string{"<turbo-stream", "Rehearsal"}},
+		{"failing stream and flash", flash, true, errors.New("boom"), http.StatusInternalServerError, nil, []string{"<turbo-stream", "Rehearsal", "Saved"}},
+		{"failing flash", flashFail, true, nil, http.StatusInternalServerError, nil, []string{"<turbo-stream", "Rehearsal", "Saved"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fstest.MapFS{
+				"views/events/_item.html":   {Data: []byte(item)},
+				"views/layouts/_flash.html": {Data: []byte(tt.flash)},
+			}
+
+			core, err := bow.NewCore(files, bow.WithLogger(log.New(io.Discard, "", 0)), bow.WithSession(testSessionKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := &application{Core: core}
+
+			h := app.Session.Enable(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.withFlash {
+					app.Session.Put(r, "flash", "Saved")
+				}
+				app.renderStream(bow.ActionReplace, "item", w, r, "events/item", streamItem{Name: "Rehearsal", err: tt.err})
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", nil))
+
+			if w.Code != tt.code {
+				t.Errorf("got status %d, want %d", w.Code, tt.code)
+			}
+
+			body := w.Body.String()
+			if tt.code != http.StatusOK && body != http.StatusText(tt.code)+"\n" {
+				t.Errorf("got body %q, want only the error", body)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("body %q does not contain %q", body, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("body %q contains %q", body, s)
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(t, func(cfg *config) {
+		cfg.basicAuthUser, cfg.basicAuthHash = "choir", hash
+	})
+
+	var logs bytes.Buffer
+	app.Logger = log.New(&logs, "", 0)
+
+	h := app.routes()
+
+	tests := []struct {
+		name           string
+		user, password string
+		code           int
+		log            string
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized, "GET /assets/logo.svg"},
+		{"wrong password", "choir", "guess", http.StatusUnauthorized, `wrong basic auth credentials for user "choir"`},
+		{"wrong user", "admin", "secret", http.StatusUnauthorized, `wrong basic auth credentials for user "admin"`},
+		{"right credentials", "choir", "secret", http.StatusOK, "GET /assets/logo.svg"},
+		{"known credentials", "choir", "secret", http.StatusOK, "GET /assets/logo.svg"},
+	}
+
+	for _, tt := range tests {
+		logs.Reset()
+
+		r := httptest.NewRequest(http.MethodGet, "/assets/logo.svg", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.password)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.code)
+		}
+		if tt.code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: credentials are not asked for", tt.name)
+		}
+		if !strings.Contains(logs.String(), tt.log) {
+			t.Errorf("%s: got logs %q, want %q", tt.name, logs.String(), tt.log)
+		}
+	}
+
+	if known, _ := app.basicAuthDigest.Load().([]byte); known == nil {
+		t.Errorf("the digest of the right credentials is not kept")
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Alice", "Alice"},
+		{"", ""},
+		{"=1+2", "'=1+2"},
+		{"+33 6 12 34 56 78", "'+33 6 12 34 56 78"},
+		{"-2", "'-2"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"Jean-Pierre", "Jean-Pierre"},
+	}
+
+	for _, tt := range tests {
+		if got := csvCell(tt.in); got != tt.want {
+			t.Errorf("csvCell(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}